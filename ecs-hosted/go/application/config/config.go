@@ -1,11 +1,14 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
 
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/log"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
 )
@@ -27,9 +30,31 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 	resource.Region = awsConfig.Require("region")
 	resource.Profile = awsConfig.Get("profile")
 
+	// providers for other regions and AWS SDK clients authenticate with the same settings as the default provider
+	resource.AwsSettings, err = common.ReadAwsSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	resource.ProjectName = ctx.Project()
 	resource.StackName = ctx.Stack()
 
+	// user defined tags are applied, along with the project and stack, to every taggable resource
+	var tags map[string]string
+	err = appConfig.GetObject("tags", &tags)
+	if err != nil {
+		return nil, fmt.Errorf("tags must be a map of tag keys to string values: %w", err)
+	}
+
+	resource.Tags, err = common.MergeTags(map[string]string{
+		"project": resource.ProjectName,
+		"stack":   resource.StackName,
+	}, tags)
+
+	if err != nil {
+		return nil, err
+	}
+
 	// enabling private LB and limiting egress will enforce strict egress limits on ECS services as well as provide an additional internal LB for the API service
 	resource.EnablePrivateLoadBalancerAndLimitEgress = appConfig.GetBool("enablePrivateLoadBalancerAndLimitEgress")
 
@@ -43,6 +68,15 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 	// allows user defined prefix to be prepended to the images. eg- upstream/pulumi/service:image:tag
 	resource.ImagePrefix = appConfig.Get("imagePrefix")
 
+	// when set, the checkpoint, policy pack and metadata buckets are replicated to this region
+	resource.DrRegion = appConfig.Get("drRegion")
+	if resource.DrRegion != "" && resource.DrRegion == resource.Region {
+		return nil, errors.New("drRegion must be different from the primary aws:region")
+	}
+
+	// replicas of KMS encrypted objects must be re-encrypted with a key in the DR region
+	resource.DrKmsKeyArn = appConfig.Get("drKmsKeyArn")
+
 	// if not present, we assume ECR repo is present in our "current" AWS account
 	resource.EcrRepoAccountId = appConfig.Get("ecrRepoAccountId")
 
@@ -52,6 +86,33 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 		return nil, err
 	}
 
+	// natless mode is chosen in the infrastructure stack and limits ECS egress to the VPC endpoints; the console reaches the API through the internal LB, so it is required
+	if appConfig.Get("enableNatlessMode") != "" {
+		return nil, errors.New("enableNatlessMode is read from the infrastructure stack's natlessMode output; remove it from the application stack")
+	}
+
+	natlessMode, err := stackRef.GetOutputDetails("natlessMode")
+	if err != nil {
+		return nil, err
+	}
+
+	resource.EnableNatlessMode = natlessMode.Value == true
+	if resource.EnableNatlessMode {
+		resource.EnablePrivateLoadBalancerAndLimitEgress = true
+
+		// interface endpoints created by the infrastructure stack, keyed by service, eg- kinesis-firehose
+		vpcEndpointIds, err := stackRef.GetOutputDetails("vpcEndpointIds")
+		if err != nil {
+			return nil, err
+		}
+
+		if ids, ok := vpcEndpointIds.Value.(map[string]any); ok {
+			for service := range ids {
+				resource.VpcEndpointServices = append(resource.VpcEndpointServices, service)
+			}
+		}
+	}
+
 	// retrieve networking, database, and VPC output values from the infrastack
 	resource.VpcId = stackRef.GetStringOutput(pulumi.String("vpcId"))
 	resource.PublicSubnetIds = OutputToStringArray(stackRef.GetOutput(pulumi.String("publicSubnetIds")))
@@ -60,11 +121,14 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 
 	resource.DatabaseArgs = &DatabaseArgs{
 		ClusterEndpoint: stackRef.GetStringOutput(pulumi.String("dbClusterEndpoint")),
+		ProxyEndpoint:   OutputToString(stackRef.GetOutput(pulumi.String("dbProxyEndpoint"))),
 		Name:            stackRef.GetStringOutput(pulumi.String("dbName")),
-		Username:        stackRef.GetStringOutput(pulumi.String("dbUsername")),
-		Password:        stackRef.GetStringOutput(pulumi.String("dbPassword")),
-		Port:            stackRef.GetIntOutput(pulumi.String("dbPort")),
-		SecurityGroupId: stackRef.GetStringOutput(pulumi.String("dbSecurityGroupId")),
+		// Aurora managed credentials; the password itself never passes through stack outputs
+		CredentialsSecretArn: stackRef.GetStringOutput(pulumi.String("dbCredentialsSecretArn")),
+		// customer managed key of an existing database's secret; empty when the tasks already have access to it
+		CredentialsKmsKeyArn: OutputToString(stackRef.GetOutput(pulumi.String("dbCredentialsKmsKeyArn"))),
+		Port:                 stackRef.GetIntOutput(pulumi.String("dbPort")),
+		SecurityGroupId:      stackRef.GetStringOutput(pulumi.String("dbSecurityGroupId")),
 	}
 
 	resource.HasOpenSearch = appConfig.GetBool("enableOpenSearch")
@@ -73,6 +137,57 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 	resource.OpenSearchDomainName = stackRef.GetStringOutput(pulumi.String("opensearchDomainName"))
 	resource.OpenSearchEndpoint = stackRef.GetStringOutput(pulumi.String("opensearchEndpoint"))
 
+	// the managed domain only admits the API security group created by the infrastructure stack, and the API runs with the role it grants access to; other search options don't export them
+	resource.ApiTaskRoleName, err = getOptionalStringOutput(stackRef, "apiTaskRoleName")
+	if err != nil {
+		return nil, err
+	}
+
+	resource.ApiTaskRoleArn, err = getOptionalStringOutput(stackRef, "apiTaskRoleArn")
+	if err != nil {
+		return nil, err
+	}
+
+	resource.ApiSecurityGroupId, err = getOptionalStringOutput(stackRef, "apiSecurityGroupId")
+	if err != nil {
+		return nil, err
+	}
+
+	// the managed domain signs the API in with its admin user unless the infrastructure stack opted in to the API role as master user
+	opensearchIamMasterUser, err := stackRef.GetOutputDetails("opensearchIamMasterUser")
+	if err != nil {
+		return nil, err
+	}
+
+	resource.OpenSearchIamMasterUser = opensearchIamMasterUser.Value == true
+
+	// the search backend is chosen in the infrastructure stack; a serverless collection is reached with SigV4 signed requests instead of the admin user
+	if appConfig.Get("useOpenSearchServerless") != "" {
+		return nil, errors.New("useOpenSearchServerless is read from the infrastructure stack's opensearchServerless output; remove it from the application stack")
+	}
+
+	opensearchServerless, err := stackRef.GetOutputDetails("opensearchServerless")
+	if err != nil {
+		return nil, err
+	}
+
+	resource.UseOpenSearchServerless = opensearchServerless.Value == true
+
+	// customer managed key for data at rest; empty when the infrastructure stack uses AWS managed keys
+	resource.DataKmsKeyArn = OutputToString(stackRef.GetOutput(pulumi.String("dataKmsKeyArn")))
+
+	// S3 only replicates KMS encrypted objects that it can re-encrypt in the DR region; without a DR key the replicas would stay empty
+	if resource.DrRegion != "" && resource.DrKmsKeyArn == "" {
+		dataKmsKeyArn, err := getOptionalStringOutput(stackRef, "dataKmsKeyArn")
+		if err != nil {
+			return nil, err
+		}
+
+		if dataKmsKeyArn != "" {
+			return nil, errors.New("drKmsKeyArn is required with drRegion when the infrastructure stack encrypts data with dataKmsKeyArn or createDataKmsKey")
+		}
+	}
+
 	// this SG protects the VPCEs created in the infrastructure stack
 	resource.EndpointSecurityGroup = stackRef.GetStringOutput(pulumi.String("endpointSecurityGroupId"))
 
@@ -112,7 +227,10 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 	hydrateApiValues(appConfig, &resource)
 	hydrateConsoleValues(appConfig, &resource)
 
-	// hydrateInsightsValues(appConfig, &resource)
+	err = hydrateInsightsValues(appConfig, &resource)
+	if err != nil {
+		return nil, err
+	}
 
 	// only populate our SMTP config if required values are present
 	smtpServer := appConfig.Get("smtpServer")
@@ -127,21 +245,45 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 		}
 	}
 
-	resource.LogType = log.LogType(appConfig.GetFloat64("logType"))
+	// logType is a driver name, eg- awslogs, or the numeric index of older configurations; logArgs are checked against the driver's schema
+	resource.LogType, err = log.ParseLogType(appConfig.Get("logType"))
+	if err != nil {
+		return nil, err
+	}
+
 	resource.LogArgs = appConfig.Get("logArgs")
+	err = log.ValidateLogArgs(resource.LogType, resource.LogArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = hydrateLogArchiveValues(appConfig, &resource)
+	if err != nil {
+		return nil, err
+	}
+
+	// referenced resources are checked up front so misconfiguration fails before anything is created
+	err = runPreflight(ctx, &resource)
+	if err != nil {
+		return nil, err
+	}
 
 	return &resource, nil
 }
 
 type ConfigArgs struct {
 	// AWS Values
-	Region    string
-	Profile   string
-	AccountId string
+	Region      string
+	Profile     string
+	AwsSettings *common.AwsSettings
+	AccountId   string
+	DrRegion    string
+	DrKmsKeyArn string
 
 	// Project Values
 	ProjectName string
 	StackName   string
+	Tags        map[string]string
 
 	// Pre-Existing AWS Resources
 	AcmCertificateArn     string
@@ -155,6 +297,7 @@ type ConfigArgs struct {
 	DatabaseArgs          *DatabaseArgs
 	EndpointSecurityGroup pulumi.StringOutput
 	PrefixListId          pulumi.StringOutput
+	DataKmsKeyArn         pulumi.StringOutput
 
 	ImagePrefix        string
 	ImageTag           string
@@ -167,6 +310,8 @@ type ConfigArgs struct {
 	WhiteListCidrBlocks []string
 
 	EnablePrivateLoadBalancerAndLimitEgress bool
+	EnableNatlessMode                       bool
+	VpcEndpointServices                     []string
 
 	// API Related Values
 	ApiDesiredNumberTasks         int
@@ -190,11 +335,21 @@ type ConfigArgs struct {
 	ConsoleHideEmailSignup            bool
 
 	// Insights Related Values
-	HasOpenSearch        bool
-	OpenSearchUser       pulumi.StringOutput
-	OpenSearchPassword   pulumi.StringOutput
-	OpenSearchDomainName pulumi.StringOutput
-	OpenSearchEndpoint   pulumi.StringOutput
+	HasOpenSearch           bool
+	UseOpenSearchServerless bool
+	OpenSearchUser          pulumi.StringOutput
+	OpenSearchPassword      pulumi.StringOutput
+	OpenSearchDomainName    pulumi.StringOutput
+	OpenSearchEndpoint      pulumi.StringOutput
+	ApiTaskRoleName         string
+	ApiTaskRoleArn          string
+	ApiSecurityGroupId      string
+	OpenSearchIamMasterUser bool
+
+	EnableOpenSearchDashboards bool
+	OpenSearchDashboardsImage  string
+	OpenSearchDashboardsMemory int
+	OpenSearchDashboardsCpu    int
 
 	// Configuration for Both
 	SamlArgs *SamlArgs
@@ -202,34 +357,91 @@ type ConfigArgs struct {
 
 	LogType log.LogType
 	LogArgs string
+
+	// Log Archival and Metrics
+	EnableLogArchive         bool
+	LogArchiveFilterPattern  string
+	LogArchiveExpirationDays int
+	EnableLogMetrics         bool
+	LogMetricNamespace       string
+	LogMetricFilters         map[string]string
+}
+
+// archival and metric filters both read the services' CloudWatch log groups
+func hydrateLogArchiveValues(appConfig *config.Config, resource *ConfigArgs) error {
+	resource.EnableLogArchive = appConfig.GetBool("enableLogArchive")
+	resource.LogArchiveFilterPattern = appConfig.Get("logArchiveFilterPattern")
+	resource.LogArchiveExpirationDays = appConfig.GetInt("logArchiveExpirationDays")
+	if resource.LogArchiveExpirationDays < 0 {
+		return errors.New("logArchiveExpirationDays must be 0, to keep archived logs forever, or a number of days")
+	}
+
+	resource.EnableLogMetrics = appConfig.GetBool("enableLogMetrics")
+	resource.LogMetricNamespace = appConfig.Get("logMetricNamespace")
+	if resource.LogMetricNamespace == "" {
+		resource.LogMetricNamespace = "PulumiSelfHosted"
+	}
+
+	if resource.EnableLogMetrics {
+		var overrides map[string]string
+		err := appConfig.GetObject("logMetricFilters", &overrides)
+		if err != nil {
+			return fmt.Errorf("logMetricFilters must be a map of metric names to filter patterns: %w", err)
+		}
+
+		resource.LogMetricFilters, err = common.LogMetricFilters(overrides)
+		if err != nil {
+			return err
+		}
+	}
+
+	if (resource.EnableLogArchive || resource.EnableLogMetrics) && resource.LogType == log.SplunkLogType {
+		return errors.New("enableLogArchive and enableLogMetrics need the service logs in CloudWatch; use logType awslogs or firelens with the cloudwatch output")
+	}
+
+	return nil
 }
 
-// func hydrateInsightsValues(appConfig *config.Config, resource *ConfigArgs) {
-// 	resource.OpenSearchInstanceType = appConfig.Get("OpenSearchInstanceType")
-// 	if resource.OpenSearchInstanceType == "" {
-// 		resource.OpenSearchInstanceType = "t3.medium.search"
-// 	}
-
-// 	resource.OpenSearchInstanceCount = appConfig.GetInt("OpenSearchInstanceCount")
-// 	if resource.OpenSearchInstanceCount == 0 {
-// 		resource.OpenSearchInstanceCount = 2
-// 	}
-
-// 	resource.OpenSearchVolumeSize = appConfig.GetInt("OpenSearchVolumeSize")
-// 	if resource.OpenSearchVolumeSize == 0 {
-// 		resource.OpenSearchVolumeSize = 10
-// 	}
-
-// 	resource.OpenSearchDashboardsMemory = appConfig.GetInt("OpenSearchDashboardsMemory")
-// 	if resource.OpenSearchDashboardsMemory == 0 {
-// 		resource.OpenSearchDashboardsMemory = 512
-// 	}
-
-// 	resource.OpenSearchDashboardsCpu = appConfig.GetInt("OpenSearchDashboardsCpu")
-// 	if resource.OpenSearchDashboardsCpu == 0 {
-// 		resource.OpenSearchDashboardsCpu = 256
-// 	}
-// }
+func hydrateInsightsValues(appConfig *config.Config, resource *ConfigArgs) error {
+	// the infrastructure stack's serverless collection is only used when the application enables search
+	if resource.UseOpenSearchServerless && !resource.HasOpenSearch {
+		return errors.New("the infrastructure stack uses OpenSearch Serverless, which requires enableOpenSearch")
+	}
+
+	// dashboards browse the same domain the API indexes, so they are only available alongside it
+	resource.EnableOpenSearchDashboards = appConfig.GetBool("enableOpenSearchDashboards")
+	if resource.EnableOpenSearchDashboards && !resource.HasOpenSearch {
+		return errors.New("enableOpenSearchDashboards requires enableOpenSearch")
+	}
+
+	// the dashboards container signs in with the admin user, which a serverless collection doesn't have
+	if resource.EnableOpenSearchDashboards && resource.UseOpenSearchServerless {
+		return errors.New("enableOpenSearchDashboards is not supported with useOpenSearchServerless")
+	}
+
+	// nor does the managed domain when its master user is the API role
+	if resource.EnableOpenSearchDashboards && resource.OpenSearchIamMasterUser {
+		return errors.New("enableOpenSearchDashboards is not supported with openSearchIamMasterUser; the domain only accepts requests signed by the API role")
+	}
+
+	// dashboards refuse to connect to an older OpenSearch minor version; the default matches the managed domain
+	resource.OpenSearchDashboardsImage = appConfig.Get("openSearchDashboardsImage")
+	if resource.OpenSearchDashboardsImage == "" {
+		resource.OpenSearchDashboardsImage = "public.ecr.aws/opensearchproject/opensearch-dashboards:2.13.0"
+	}
+
+	resource.OpenSearchDashboardsMemory = appConfig.GetInt("openSearchDashboardsMemory")
+	if resource.OpenSearchDashboardsMemory == 0 {
+		resource.OpenSearchDashboardsMemory = 1024
+	}
+
+	resource.OpenSearchDashboardsCpu = appConfig.GetInt("openSearchDashboardsCpu")
+	if resource.OpenSearchDashboardsCpu == 0 {
+		resource.OpenSearchDashboardsCpu = 512
+	}
+
+	return nil
+}
 
 func hydrateApiValues(appConfig *config.Config, resource *ConfigArgs) {
 	resource.ApiDesiredNumberTasks = appConfig.GetInt("apiDesiredNumberTasks")
@@ -313,13 +525,35 @@ func OutputToStringArray(output pulumi.AnyOutput) pulumi.StringArrayOutput {
 	}).(pulumi.StringArrayOutput)
 }
 
+// read while the program runs, eg- to decide which resources to create; a missing output is an empty string
+func getOptionalStringOutput(stackRef *pulumi.StackReference, name string) (string, error) {
+	output, err := stackRef.GetOutputDetails(name)
+	if err != nil {
+		return "", err
+	}
+
+	value, _ := output.Value.(string)
+	return value, nil
+}
+
+// optional stack outputs may not exist on older infrastructure stacks; treat a missing output as an empty string
+func OutputToString(output pulumi.AnyOutput) pulumi.StringOutput {
+	return output.ApplyT(func(out any) string {
+		if out == nil {
+			return ""
+		}
+		return out.(string)
+	}).(pulumi.StringOutput)
+}
+
 type DatabaseArgs struct {
-	ClusterEndpoint pulumi.StringOutput
-	Username        pulumi.StringOutput
-	Password        pulumi.StringOutput
-	Name            pulumi.StringOutput
-	SecurityGroupId pulumi.StringOutput
-	Port            pulumi.IntOutput
+	ClusterEndpoint      pulumi.StringOutput
+	ProxyEndpoint        pulumi.StringOutput
+	CredentialsSecretArn pulumi.StringOutput
+	CredentialsKmsKeyArn pulumi.StringOutput
+	Name                 pulumi.StringOutput
+	SecurityGroupId      pulumi.StringOutput
+	Port                 pulumi.IntOutput
 }
 
 type SmtpArgs struct {
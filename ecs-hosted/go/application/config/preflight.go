@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/kms"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/log"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+/*
+Look up the pre-existing AWS resources referenced by configuration before anything is created.
+Every problem found is collected so a single update reports all of them, rather than failing on the first one part way through.
+Network inputs come from the infrastructure stack, which runs its own preflight.
+*/
+func runPreflight(ctx *pulumi.Context, resource *ConfigArgs) error {
+	var report common.PreflightReport
+
+	checkCertificate(&report, resource)
+
+	key, err := kms.LookupKey(ctx, &kms.LookupKeyArgs{
+		KeyId: resource.KmsServiceKeyId,
+	})
+
+	if err != nil {
+		report.Addf("kmsServiceKeyId %s was not found or cannot be described: %v", resource.KmsServiceKeyId, err)
+	} else if key.KeyState != "Enabled" {
+		report.Addf("kmsServiceKeyId %s is %s; it must be Enabled", resource.KmsServiceKeyId, key.KeyState)
+	}
+
+	// the DR key lives in the DR region and cannot be looked up with the primary provider
+	if resource.DrKmsKeyArn != "" {
+		region, err := common.ArnRegion(resource.DrKmsKeyArn)
+		if err != nil {
+			report.Addf("drKmsKeyArn must be a key ARN: %v", err)
+		} else if region != resource.DrRegion {
+			report.Addf("drKmsKeyArn is in %s but drRegion is %s", region, resource.DrRegion)
+		}
+	}
+
+	// without a NAT, images can only be pulled from private ECR
+	if resource.EnableNatlessMode && resource.EnableOpenSearchDashboards {
+		report.AddAll(common.ValidateNatlessImage("openSearchDashboardsImage", resource.OpenSearchDashboardsImage))
+	}
+
+	if resource.EnableNatlessMode {
+		report.AddAll(log.ValidateNatlessLogArgs(resource.LogType, resource.LogArgs, resource.VpcEndpointServices))
+	}
+
+	for _, cidr := range resource.WhiteListCidrBlocks {
+		_, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			report.Addf("whiteListCideBlocks: %s is not a valid CIDR block", cidr)
+		}
+	}
+
+	return report.Err()
+}
+
+// the load balancers need an issued, unexpired certificate in the deployment region that covers the API, console and dashboards domains
+func checkCertificate(report *common.PreflightReport, resource *ConfigArgs) {
+	region, err := common.ArnRegion(resource.AcmCertificateArn)
+	if err != nil {
+		report.Addf("acmCertificateArn must be a certificate ARN: %v", err)
+		return
+	}
+
+	if region != resource.Region {
+		report.Addf("acmCertificateArn is in %s but aws:region is %s; load balancers can only use certificates from their own region", region, resource.Region)
+		return
+	}
+
+	// describe the certificate in the account the provider deploys to, not whichever the default credential chain finds
+	cfg, err := common.NewAwsSdkConfig(context.TODO(), resource.AwsSettings, resource.Region)
+	if err != nil {
+		report.Addf("unable to load AWS credentials to check acmCertificateArn: %v", err)
+		return
+	}
+
+	client := acm.NewFromConfig(cfg)
+	result, err := client.DescribeCertificate(context.TODO(), &acm.DescribeCertificateInput{
+		CertificateArn: aws.String(resource.AcmCertificateArn),
+	})
+
+	if err != nil {
+		report.Addf("acmCertificateArn %s was not found or cannot be described: %v", resource.AcmCertificateArn, err)
+		return
+	}
+
+	cert := result.Certificate
+	if cert.Status != "ISSUED" {
+		report.Addf("acmCertificateArn %s is %s; it must be ISSUED", resource.AcmCertificateArn, cert.Status)
+	}
+
+	if cert.NotAfter != nil && cert.NotAfter.Before(time.Now()) {
+		report.Addf("acmCertificateArn %s expired on %s", resource.AcmCertificateArn, cert.NotAfter.Format(time.DateOnly))
+	}
+
+	names := append([]string{aws.ToString(cert.DomainName)}, cert.SubjectAlternativeNames...)
+	domains := []string{serviceDomain(resource, "api"), serviceDomain(resource, "app")}
+	if resource.EnablePrivateLoadBalancerAndLimitEgress {
+		domains = append(domains, serviceDomain(resource, "api-internal"))
+	}
+
+	if resource.EnableOpenSearchDashboards {
+		domains = append(domains, serviceDomain(resource, "dashboards"))
+	}
+
+	for _, domain := range domains {
+		if !common.CertificateCoversDomain(names, domain) {
+			report.Addf("acmCertificateArn %s does not cover %s; its names are %s", resource.AcmCertificateArn, domain, strings.Join(names, ", "))
+		}
+	}
+}
+
+// matches the URLs built in main, eg- api.sub-domain.domain.com or api.domain.com
+func serviceDomain(resource *ConfigArgs, service string) string {
+	if resource.Route53Subdomain == "" {
+		return strings.Join([]string{service, resource.Route53ZoneName}, ".")
+	}
+
+	return strings.Join([]string{service, resource.Route53Subdomain, resource.Route53ZoneName}, ".")
+}
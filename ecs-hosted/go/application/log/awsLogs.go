@@ -6,10 +6,31 @@ import (
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+// retention periods CloudWatch Logs accepts; 0 keeps logs forever
+var logRetentionDays = map[int]bool{
+	0: true, 1: true, 3: true, 5: true, 7: true, 14: true, 30: true, 60: true, 90: true, 120: true, 150: true, 180: true,
+	365: true, 400: true, 545: true, 731: true, 1096: true, 1827: true, 2192: true, 2557: true, 2922: true, 3288: true, 3653: true,
+}
+
+func parseAwsArgs(jsonArgs string) (*AwsArgs, error) {
+	args := AwsArgs{}
+	err := decodeLogArgs(jsonArgs, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	if !logRetentionDays[args.RetentionDays] {
+		return nil, fmt.Errorf("retentionDays %d is not a retention period CloudWatch Logs supports, eg- 1, 3, 7, 14, 30, 90 or 365", args.RetentionDays)
+	}
+
+	return &args, nil
+}
+
 func NewAwsLogs(ctx *pulumi.Context, name string, args *AwsArgs, opts ...pulumi.ResourceOption) (*AwsLogs, error) {
 	lg, err := cloudwatch.NewLogGroup(ctx, fmt.Sprintf("awslogs-%s", name), &cloudwatch.LogGroupArgs{
 		NamePrefix:      pulumi.String(fmt.Sprintf("cloudwatch-%s-logs", name)),
 		RetentionInDays: pulumi.Int(args.RetentionDays),
+		KmsKeyId:        args.KmsKeyArn,
 	}, opts...)
 
 	if err != nil {
@@ -40,10 +61,28 @@ func (l AwsLogs) GetConfiguration() map[string]any {
 	}
 }
 
+// the awslogs driver runs in the ECS agent with the execution role's managed policy; no sidecar or extra permissions are needed
+func (l AwsLogs) GetSidecars() []map[string]any {
+	return nil
+}
+
+func (l AwsLogs) GetTaskRolePolicyDocs() pulumi.StringArray {
+	return nil
+}
+
+func (l AwsLogs) GetExecutionRolePolicyDocs() pulumi.StringArray {
+	return nil
+}
+
+func (l AwsLogs) GetLogGroup() *cloudwatch.LogGroup {
+	return l.LogGroup
+}
+
 type AwsArgs struct {
 	Region        string
 	Name          string
 	RetentionDays int
+	KmsKeyArn     pulumi.StringPtrInput `json:"-"`
 }
 
 type AwsLogs struct {
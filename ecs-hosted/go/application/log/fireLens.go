@@ -0,0 +1,282 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const fireLensContainerName = "log_router"
+const fireLensDefaultImage = "public.ecr.aws/aws-observability/aws-for-fluent-bit:stable"
+
+func parseFireLensArgs(jsonArgs string) (*FireLensArgs, error) {
+	args := FireLensArgs{}
+	err := decodeLogArgs(jsonArgs, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	if !logRetentionDays[args.RetentionDays] {
+		return nil, fmt.Errorf("retentionDays %d is not a retention period CloudWatch Logs supports, eg- 1, 3, 7, 14, 30, 90 or 365", args.RetentionDays)
+	}
+
+	switch args.Output {
+	case "", "cloudwatch":
+	case "s3":
+		if args.Bucket == "" {
+			return nil, fmt.Errorf("bucket is required for the s3 output")
+		}
+	case "firehose":
+		if args.DeliveryStream == "" {
+			return nil, fmt.Errorf("deliveryStream is required for the firehose output")
+		}
+	case "http":
+		if args.Host == "" {
+			return nil, fmt.Errorf("host is required for the http output")
+		}
+
+		if args.Port < 1 || args.Port > 65535 {
+			return nil, fmt.Errorf("port must be between 1 and 65535, not %d", args.Port)
+		}
+	default:
+		return nil, fmt.Errorf("output must be cloudwatch, s3, firehose or http, not %s", args.Output)
+	}
+
+	return &args, nil
+}
+
+// without a NAT the log router image must come from private ECR, and the output must be reachable through a VPC endpoint
+func validateFireLensNatless(args *FireLensArgs, vpcEndpointServices []string) []string {
+	var problems []string
+
+	image := args.Image
+	if image == "" {
+		image = fireLensDefaultImage
+	}
+
+	problems = append(problems, common.ValidateNatlessImage("logArgs image", image)...)
+
+	switch args.Output {
+	case "firehose":
+		if !slices.Contains(vpcEndpointServices, "kinesis-firehose") {
+			problems = append(problems, "the firehose output needs a kinesis-firehose VPC endpoint in natless mode; add it to extraVpcEndpoints in the infrastructure stack")
+		}
+	case "http":
+		problems = append(problems, "the http output is not supported in natless mode; the private subnets have no route to its host")
+	}
+
+	return problems
+}
+
+/*
+Route container logs through a Fluent Bit sidecar (FireLens) to CloudWatch Logs, S3, Kinesis Firehose or an HTTP endpoint.
+Each service gets its own log group; the log router writes its own logs there and, for the cloudwatch output, so do the services.
+Fluent Bit delivers logs with the task role, so the permissions the output needs are added to it.
+*/
+func NewFireLensLogs(ctx *pulumi.Context, name string, args *FireLensArgs, opts ...pulumi.ResourceOption) (*FireLensLogs, error) {
+	retentionDays := args.RetentionDays
+	if retentionDays == 0 {
+		retentionDays = 7
+	}
+
+	image := args.Image
+	if image == "" {
+		image = fireLensDefaultImage
+	}
+
+	output := args.Output
+	if output == "" {
+		output = "cloudwatch"
+	}
+
+	lg, err := cloudwatch.NewLogGroup(ctx, fmt.Sprintf("firelens-%s", name), &cloudwatch.LogGroupArgs{
+		NamePrefix:      pulumi.String(fmt.Sprintf("firelens-%s-logs", name)),
+		RetentionInDays: pulumi.Int(retentionDays),
+		KmsKeyId:        args.KmsKeyArn,
+	}, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	outputOptions := map[string]any{}
+	var statements []map[string]any
+
+	switch output {
+	case "cloudwatch":
+		outputOptions["Name"] = "cloudwatch_logs"
+		outputOptions["region"] = args.Region
+		outputOptions["log_group_name"] = lg.Name
+		outputOptions["log_stream_prefix"] = fmt.Sprintf("%s/", name)
+		outputOptions["auto_create_group"] = "false"
+	case "s3":
+		outputOptions["Name"] = "s3"
+		outputOptions["region"] = args.Region
+		outputOptions["bucket"] = args.Bucket
+		outputOptions["compression"] = "gzip"
+		outputOptions["s3_key_format"] = fmt.Sprintf("/%s/%%Y/%%m/%%d/%%H/$UUID.gz", name)
+
+		bucketArn := common.GetIamPolicyArn(args.Region, fmt.Sprintf("arn:aws:s3:::%s/*", args.Bucket))
+		statements = append(statements, map[string]any{
+			"Effect":   "Allow",
+			"Action":   []string{"s3:PutObject"},
+			"Resource": []string{bucketArn},
+		})
+	case "firehose":
+		caller, err := aws.GetCallerIdentity(ctx, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		outputOptions["Name"] = "kinesis_firehose"
+		outputOptions["region"] = args.Region
+		outputOptions["delivery_stream"] = args.DeliveryStream
+
+		streamArn := common.GetIamPolicyArn(args.Region, fmt.Sprintf("arn:aws:firehose:%s:%s:deliverystream/%s", args.Region, caller.AccountId, args.DeliveryStream))
+		statements = append(statements, map[string]any{
+			"Effect":   "Allow",
+			"Action":   []string{"firehose:PutRecordBatch"},
+			"Resource": []string{streamArn},
+		})
+	case "http":
+		uri := args.Uri
+		if uri == "" {
+			uri = "/"
+		}
+
+		outputOptions["Name"] = "http"
+		outputOptions["Host"] = args.Host
+		outputOptions["Port"] = fmt.Sprintf("%d", args.Port)
+		outputOptions["URI"] = uri
+		outputOptions["Format"] = "json_lines"
+		outputOptions["tls"] = "On"
+	default:
+		return nil, fmt.Errorf("output must be cloudwatch, s3, firehose or http, not %s", output)
+	}
+
+	// user supplied Fluent Bit options are applied over the defaults, eg- to tune buffering or add headers
+	for k, v := range args.Options {
+		outputOptions[k] = v
+	}
+
+	policy := lg.Arn.ApplyT(func(arn string) (string, error) {
+		policyStatements := append([]map[string]any{}, statements...)
+
+		// the cloudwatch output writes to the service's log group with the task role
+		if output == "cloudwatch" {
+			policyStatements = append(policyStatements, map[string]any{
+				"Effect":   "Allow",
+				"Action":   []string{"logs:CreateLogStream", "logs:DescribeLogStreams", "logs:PutLogEvents"},
+				"Resource": []string{fmt.Sprintf("%s:*", arn)},
+			})
+		}
+
+		doc, err := json.Marshal(map[string]any{
+			"Version":   "2012-10-17",
+			"Statement": policyStatements,
+		})
+
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	resource := FireLensLogs{
+		Image:          image,
+		Output:         output,
+		Region:         args.Region,
+		Name:           name,
+		LogGroup:       lg,
+		TaskRolePolicy: policy,
+		HasPolicy:      output != "http",
+		Outputs: map[string]any{
+			"logGroupId":    lg.ID(),
+			"outputOptions": outputOptions,
+		},
+	}
+
+	return &resource, nil
+}
+
+func (l FireLensLogs) GetConfiguration() map[string]any {
+	return map[string]any{
+		"logDriver": "awsfirelens",
+		"options":   l.Outputs["outputOptions"],
+	}
+}
+
+// the log router is essential; if Fluent Bit stops, the task is replaced rather than losing logs
+func (l FireLensLogs) GetSidecars() []map[string]any {
+	return []map[string]any{
+		{
+			"name":      fireLensContainerName,
+			"image":     l.Image,
+			"essential": true,
+			"firelensConfiguration": map[string]any{
+				"type": "fluentbit",
+				"options": map[string]any{
+					"enable-ecs-log-metadata": "true",
+				},
+			},
+			"logConfiguration": map[string]any{
+				"logDriver": "awslogs",
+				"options": map[string]any{
+					"awslogs-region":        l.Region,
+					"awslogs-group":         l.Outputs["logGroupId"],
+					"awslogs-stream-prefix": "firelens",
+				},
+			},
+		},
+	}
+}
+
+func (l FireLensLogs) GetTaskRolePolicyDocs() pulumi.StringArray {
+	if !l.HasPolicy {
+		return nil
+	}
+
+	return pulumi.StringArray{l.TaskRolePolicy}
+}
+
+// the log router image is pulled and its own logs are written with the execution role's managed policy
+func (l FireLensLogs) GetExecutionRolePolicyDocs() pulumi.StringArray {
+	return nil
+}
+
+// only the cloudwatch output writes the service's logs to the log group; otherwise it holds the log router's own logs
+func (l FireLensLogs) GetLogGroup() *cloudwatch.LogGroup {
+	if l.Output != "cloudwatch" {
+		return nil
+	}
+
+	return l.LogGroup
+}
+
+type FireLensArgs struct {
+	Region         string
+	Name           string
+	RetentionDays  int
+	Image          string
+	Output         string
+	Bucket         string
+	DeliveryStream string
+	Host           string
+	Port           int
+	Uri            string
+	Options        map[string]string
+	KmsKeyArn      pulumi.StringPtrInput `json:"-"`
+}
+
+type FireLensLogs struct {
+	Image          string
+	Output         string
+	Region         string
+	Name           string
+	LogGroup       *cloudwatch.LogGroup
+	TaskRolePolicy pulumi.StringOutput
+	HasPolicy      bool
+	Outputs        map[string]any
+}
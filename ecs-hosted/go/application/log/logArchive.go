@@ -0,0 +1,307 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/kinesis"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/s3"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/utils"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// objects land under the log group they came from, then by hour
+const logArchivePrefix = "logs/!{partitionKeyFromQuery:logGroup}/!{timestamp:yyyy/MM/dd/HH}/"
+const logArchiveErrorPrefix = "errors/!{firehose:error-output-type}/!{timestamp:yyyy/MM/dd/HH}/"
+
+/*
+Archive service logs to S3 so they outlive the log group's retention.
+Log groups are subscribed to a Kinesis Firehose stream, which decompresses the CloudWatch Logs records,
+partitions them by log group and delivers them to a dedicated bucket, encrypted with the data key when one is provided.
+*/
+func NewLogArchive(ctx *pulumi.Context, name string, args *LogArchiveArgs, opts ...pulumi.ResourceOption) (*LogArchive, error) {
+	var resource LogArchive
+
+	err := ctx.RegisterComponentResource("pulumi:logArchive", name, &resource, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// create our parented options
+	options := append(opts, pulumi.Parent(&resource))
+
+	resource.Bucket, err = s3.NewBucket(ctx, fmt.Sprintf("%s-bucket", name), &s3.BucketArgs{}, append(options, pulumi.Protect(true))...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s3.NewBucketPublicAccessBlock(ctx, fmt.Sprintf("%s-public-access", name), &s3.BucketPublicAccessBlockArgs{
+		Bucket:                resource.Bucket.ID(),
+		BlockPublicAcls:       pulumi.Bool(true),
+		BlockPublicPolicy:     pulumi.Bool(true),
+		IgnorePublicAcls:      pulumi.Bool(true),
+		RestrictPublicBuckets: pulumi.Bool(true),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := args.KmsKeyArn.ApplyT(func(arn string) string {
+		if arn == "" {
+			return "AES256"
+		}
+		return "aws:kms"
+	}).(pulumi.StringOutput)
+
+	_, err = s3.NewBucketServerSideEncryptionConfigurationV2(ctx, fmt.Sprintf("%s-encryption", name), &s3.BucketServerSideEncryptionConfigurationV2Args{
+		Bucket: resource.Bucket.ID(),
+		Rules: s3.BucketServerSideEncryptionConfigurationV2RuleArray{
+			&s3.BucketServerSideEncryptionConfigurationV2RuleArgs{
+				ApplyServerSideEncryptionByDefault: &s3.BucketServerSideEncryptionConfigurationV2RuleApplyServerSideEncryptionByDefaultArgs{
+					SseAlgorithm:   algorithm,
+					KmsMasterKeyId: utils.OptionalString(args.KmsKeyArn),
+				},
+				BucketKeyEnabled: pulumi.Bool(true),
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// archived logs are kept forever unless an expiration is configured
+	if args.ExpirationDays > 0 {
+		_, err = s3.NewBucketLifecycleConfigurationV2(ctx, fmt.Sprintf("%s-lifecycle", name), &s3.BucketLifecycleConfigurationV2Args{
+			Bucket: resource.Bucket.ID(),
+			Rules: s3.BucketLifecycleConfigurationV2RuleArray{
+				&s3.BucketLifecycleConfigurationV2RuleArgs{
+					Id:     pulumi.String("expire-archived-logs"),
+					Status: pulumi.String("Enabled"),
+					Filter: &s3.BucketLifecycleConfigurationV2RuleFilterArgs{
+						Prefix: pulumi.String(""),
+					},
+					Expiration: &s3.BucketLifecycleConfigurationV2RuleExpirationArgs{
+						Days: pulumi.Int(args.ExpirationDays),
+					},
+				},
+			},
+		}, options...)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Firehose assumes this role to write to the bucket
+	firehoseRole, err := iam.NewRole(ctx, fmt.Sprintf("%s-firehose-role", name), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "firehose.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}]
+		}`),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	firehosePolicy := pulumi.All(resource.Bucket.Arn, args.KmsKeyArn).ApplyT(func(applyArgs []any) (string, error) {
+		bucketArn := applyArgs[0].(string)
+		statements := []map[string]any{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:GetBucketLocation", "s3:ListBucket", "s3:ListBucketMultipartUploads"},
+				"Resource": []string{bucketArn},
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:AbortMultipartUpload", "s3:GetObject", "s3:PutObject"},
+				"Resource": []string{fmt.Sprintf("%s/*", bucketArn)},
+			},
+		}
+
+		if kmsKeyArn := applyArgs[1].(string); kmsKeyArn != "" {
+			statements = append(statements, map[string]any{
+				"Effect":   "Allow",
+				"Action":   []string{"kms:Decrypt", "kms:GenerateDataKey"},
+				"Resource": []string{kmsKeyArn},
+			})
+		}
+
+		doc, err := json.Marshal(map[string]any{
+			"Version":   "2012-10-17",
+			"Statement": statements,
+		})
+
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	firehoseRolePolicy, err := iam.NewRolePolicy(ctx, fmt.Sprintf("%s-firehose-policy", name), &iam.RolePolicyArgs{
+		Role:   firehoseRole.Name,
+		Policy: firehosePolicy,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// subscription records are gzipped batches; decompress them so the log group can be read for partitioning
+	streamOptions := append(options, pulumi.DependsOn([]pulumi.Resource{firehoseRolePolicy}))
+	resource.DeliveryStream, err = kinesis.NewFirehoseDeliveryStream(ctx, fmt.Sprintf("%s-stream", name), &kinesis.FirehoseDeliveryStreamArgs{
+		Destination: pulumi.String("extended_s3"),
+		ExtendedS3Configuration: &kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationArgs{
+			RoleArn:           firehoseRole.Arn,
+			BucketArn:         resource.Bucket.Arn,
+			Prefix:            pulumi.String(logArchivePrefix),
+			ErrorOutputPrefix: pulumi.String(logArchiveErrorPrefix),
+			CompressionFormat: pulumi.String("GZIP"),
+			KmsKeyArn:         utils.OptionalString(args.KmsKeyArn),
+			// dynamic partitioning requires a buffer of at least 64 MB
+			BufferingSize:     pulumi.Int(64),
+			BufferingInterval: pulumi.Int(300),
+			DynamicPartitioningConfiguration: &kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationDynamicPartitioningConfigurationArgs{
+				Enabled: pulumi.Bool(true),
+			},
+			ProcessingConfiguration: &kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationArgs{
+				Enabled: pulumi.Bool(true),
+				Processors: kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorArray{
+					&kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorArgs{
+						Type: pulumi.String("Decompression"),
+						Parameters: kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorParameterArray{
+							&kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorParameterArgs{
+								ParameterName:  pulumi.String("CompressionFormat"),
+								ParameterValue: pulumi.String("GZIP"),
+							},
+						},
+					},
+					&kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorArgs{
+						Type: pulumi.String("MetadataExtraction"),
+						Parameters: kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorParameterArray{
+							&kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorParameterArgs{
+								ParameterName:  pulumi.String("MetadataExtractionQuery"),
+								ParameterValue: pulumi.String("{logGroup: .logGroup}"),
+							},
+							&kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorParameterArgs{
+								ParameterName:  pulumi.String("JsonParsingEngine"),
+								ParameterValue: pulumi.String("JQ-1.6"),
+							},
+						},
+					},
+					&kinesis.FirehoseDeliveryStreamExtendedS3ConfigurationProcessingConfigurationProcessorArgs{
+						Type: pulumi.String("AppendDelimiterToRecord"),
+					},
+				},
+			},
+		},
+	}, streamOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// CloudWatch Logs assumes this role to put subscribed events on the stream
+	sourceArn := common.GetIamPolicyArn(args.Region, fmt.Sprintf("arn:aws:logs:%s:%s:*", args.Region, args.AccountId))
+	subscriptionAssumeRolePolicy, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Effect": "Allow",
+				"Principal": map[string]any{
+					"Service": "logs.amazonaws.com",
+				},
+				"Action": "sts:AssumeRole",
+				"Condition": map[string]any{
+					"StringLike": map[string]any{
+						"aws:SourceArn": sourceArn,
+					},
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	resource.SubscriptionRole, err = iam.NewRole(ctx, fmt.Sprintf("%s-subscription-role", name), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(string(subscriptionAssumeRolePolicy)),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionPolicy := resource.DeliveryStream.Arn.ApplyT(func(streamArn string) (string, error) {
+		doc, err := json.Marshal(map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []map[string]any{
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"firehose:PutRecord", "firehose:PutRecordBatch"},
+					"Resource": []string{streamArn},
+				},
+			},
+		})
+
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	resource.subscriptionRolePolicy, err = iam.NewRolePolicy(ctx, fmt.Sprintf("%s-subscription-policy", name), &iam.RolePolicyArgs{
+		Role:   resource.SubscriptionRole.Name,
+		Policy: subscriptionPolicy,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resource.filterPattern = args.FilterPattern
+	resource.options = options
+
+	return &resource, nil
+}
+
+// Subscribe sends the events of a log group that match the archive's filter pattern to the archive
+func (a *LogArchive) Subscribe(ctx *pulumi.Context, name string, logGroup *cloudwatch.LogGroup) error {
+	// CloudWatch Logs checks it can assume the role when the filter is created
+	filterOptions := append(a.options, pulumi.DependsOn([]pulumi.Resource{a.subscriptionRolePolicy}))
+	_, err := cloudwatch.NewLogSubscriptionFilter(ctx, fmt.Sprintf("%s-archive", name), &cloudwatch.LogSubscriptionFilterArgs{
+		Name:           pulumi.String("pulumi-log-archive"),
+		LogGroup:       logGroup.Name,
+		FilterPattern:  pulumi.String(a.filterPattern),
+		DestinationArn: a.DeliveryStream.Arn,
+		RoleArn:        a.SubscriptionRole.Arn,
+	}, filterOptions...)
+
+	return err
+}
+
+type LogArchiveArgs struct {
+	Region         string
+	AccountId      string
+	KmsKeyArn      pulumi.StringOutput
+	FilterPattern  string
+	ExpirationDays int
+}
+
+type LogArchive struct {
+	pulumi.ResourceState
+
+	Bucket           *s3.Bucket
+	DeliveryStream   *kinesis.FirehoseDeliveryStream
+	SubscriptionRole *iam.Role
+
+	subscriptionRolePolicy *iam.RolePolicy
+	filterPattern          string
+	options                []pulumi.ResourceOption
+}
@@ -1,8 +1,14 @@
 package log
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
@@ -10,28 +16,198 @@ type LogType int64
 
 const (
 	AwsLogType LogType = iota
+	FireLensLogType
+	SplunkLogType
 )
 
-func NewLogs(ctx *pulumi.Context, logType LogType, name string, region string, jsonArgs string, opts ...pulumi.ResourceOption) LogDriver {
-	switch logType {
-	case AwsLogType:
-		ctx.Log.Debug("creating awslogs (cloudwatch) log configuration", nil)
+// a log driver validates its logArgs when the configuration is read and creates its resources when the services are deployed
+type logDriverRegistration struct {
+	name     string
+	validate func(jsonArgs string) error
+	create   func(ctx *pulumi.Context, name string, region string, kmsKeyArn pulumi.StringPtrInput, jsonArgs string, opts ...pulumi.ResourceOption) (LogDriver, error)
+	// problems delivering logs without a NAT, given the services with a VPC endpoint; nil when the driver only uses the default endpoints
+	validateNatless func(jsonArgs string, vpcEndpointServices []string) []string
+}
+
+var logDrivers = map[LogType]logDriverRegistration{
+	AwsLogType: {
+		name: "awslogs",
+		validate: func(jsonArgs string) error {
+			_, err := parseAwsArgs(jsonArgs)
+			return err
+		},
+		create: func(ctx *pulumi.Context, name string, region string, kmsKeyArn pulumi.StringPtrInput, jsonArgs string, opts ...pulumi.ResourceOption) (LogDriver, error) {
+			args, err := parseAwsArgs(jsonArgs)
+			if err != nil {
+				return nil, err
+			}
+
+			args.Region = region
+			args.KmsKeyArn = kmsKeyArn
+
+			logs, err := NewAwsLogs(ctx, name, args, opts...)
+			if err != nil {
+				return nil, err
+			}
+
+			return logs, nil
+		},
+	},
+	FireLensLogType: {
+		name: "firelens",
+		validate: func(jsonArgs string) error {
+			_, err := parseFireLensArgs(jsonArgs)
+			return err
+		},
+		validateNatless: func(jsonArgs string, vpcEndpointServices []string) []string {
+			args, err := parseFireLensArgs(jsonArgs)
+			if err != nil {
+				return nil
+			}
+
+			return validateFireLensNatless(args, vpcEndpointServices)
+		},
+		create: func(ctx *pulumi.Context, name string, region string, kmsKeyArn pulumi.StringPtrInput, jsonArgs string, opts ...pulumi.ResourceOption) (LogDriver, error) {
+			args, err := parseFireLensArgs(jsonArgs)
+			if err != nil {
+				return nil, err
+			}
+
+			args.Region = region
+			args.KmsKeyArn = kmsKeyArn
+
+			logs, err := NewFireLensLogs(ctx, name, args, opts...)
+			if err != nil {
+				return nil, err
+			}
+
+			return logs, nil
+		},
+	},
+	SplunkLogType: {
+		name: "splunk",
+		validate: func(jsonArgs string) error {
+			_, err := parseSplunkArgs(jsonArgs)
+			return err
+		},
+		validateNatless: func(jsonArgs string, vpcEndpointServices []string) []string {
+			return validateSplunkNatless()
+		},
+		create: func(ctx *pulumi.Context, name string, region string, kmsKeyArn pulumi.StringPtrInput, jsonArgs string, opts ...pulumi.ResourceOption) (LogDriver, error) {
+			args, err := parseSplunkArgs(jsonArgs)
+			if err != nil {
+				return nil, err
+			}
+
+			logs, err := NewSplunkLogs(name, args)
+			if err != nil {
+				return nil, err
+			}
+
+			return logs, nil
+		},
+	},
+}
+
+// ParseLogType accepts a log driver name, eg- awslogs, or the numeric index older configurations used. awslogs is the default.
+func ParseLogType(value string) (LogType, error) {
+	if value == "" {
+		return AwsLogType, nil
+	}
 
-		args := AwsArgs{}
-		json.Unmarshal([]byte(jsonArgs), &args)
-		args.Region = region
+	for logType, driver := range logDrivers {
+		if driver.name == value {
+			return logType, nil
+		}
+	}
 
-		logs, err := NewAwsLogs(ctx, name, &args, opts...)
-		if err != nil {
-			return nil
+	index, err := strconv.ParseFloat(value, 64)
+	if err == nil && index == float64(int64(index)) {
+		if _, ok := logDrivers[LogType(index)]; ok {
+			return LogType(index), nil
 		}
+	}
+
+	return 0, fmt.Errorf("logType must be one of %s, not %q", strings.Join(logDriverNames(), ", "), value)
+}
+
+// ValidateLogArgs checks logArgs against the schema of the log driver, so mistakes surface before any resources are created.
+func ValidateLogArgs(logType LogType, jsonArgs string) error {
+	driver, ok := logDrivers[logType]
+	if !ok {
+		return fmt.Errorf("unknown logType %d", logType)
+	}
+
+	err := driver.validate(jsonArgs)
+	if err != nil {
+		return fmt.Errorf("logArgs are invalid for logType %s: %w", driver.name, err)
+	}
+
+	return nil
+}
+
+// ValidateNatlessLogArgs reports what keeps the log driver from pulling its images or delivering logs without a NAT.
+func ValidateNatlessLogArgs(logType LogType, jsonArgs string, vpcEndpointServices []string) []string {
+	driver, ok := logDrivers[logType]
+	if !ok || driver.validateNatless == nil {
+		return nil
+	}
+
+	return driver.validateNatless(jsonArgs, vpcEndpointServices)
+}
+
+func NewLogs(ctx *pulumi.Context, logType LogType, name string, region string, kmsKeyArn pulumi.StringPtrInput, jsonArgs string, opts ...pulumi.ResourceOption) (LogDriver, error) {
+	driver, ok := logDrivers[logType]
+	if !ok {
+		return nil, fmt.Errorf("unknown logType %d", logType)
+	}
+
+	ctx.Log.Debug(fmt.Sprintf("creating %s log configuration for %s", driver.name, name), nil)
 
-		return logs
+	logs, err := driver.create(ctx, name, region, kmsKeyArn, jsonArgs, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s logs for %s: %w", driver.name, name, err)
+	}
+
+	return logs, nil
+}
+
+// decode logArgs into the driver's arguments; unknown keys are rejected so typos are not silently ignored
+func decodeLogArgs(jsonArgs string, args any) error {
+	if strings.TrimSpace(jsonArgs) == "" {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(jsonArgs)))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(args)
+	if err != nil {
+		return fmt.Errorf("logArgs must be a JSON object: %w", err)
 	}
 
 	return nil
 }
 
+func logDriverNames() []string {
+	var names []string
+	for _, driver := range logDrivers {
+		names = append(names, driver.name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
 type LogDriver interface {
+	// log configuration of the service's own container
 	GetConfiguration() map[string]any
+	// containers that run alongside the service's container, eg- a log router
+	GetSidecars() []map[string]any
+	// policies the task role needs to deliver logs
+	GetTaskRolePolicyDocs() pulumi.StringArray
+	// policies the execution role needs to start the task, eg- to read a log driver secret
+	GetExecutionRolePolicyDocs() pulumi.StringArray
+	// log group holding the service's own logs; nil when they are delivered outside CloudWatch
+	GetLogGroup() *cloudwatch.LogGroup
 }
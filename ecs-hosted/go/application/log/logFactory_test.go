@@ -0,0 +1,138 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLogType(t *testing.T) {
+	cases := map[string]LogType{
+		"":         AwsLogType,
+		"awslogs":  AwsLogType,
+		"firelens": FireLensLogType,
+		"splunk":   SplunkLogType,
+		"0":        AwsLogType,
+		"1":        FireLensLogType,
+		"2":        SplunkLogType,
+	}
+
+	for value, expected := range cases {
+		logType, err := ParseLogType(value)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", value, err)
+		}
+
+		if logType != expected {
+			t.Fatalf("expected %q to be %d, got %d", value, expected, logType)
+		}
+	}
+
+	for _, value := range []string{"cloudwatch", "3", "1.5", "-1"} {
+		_, err := ParseLogType(value)
+		if err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+
+		if !strings.Contains(err.Error(), "awslogs, firelens, splunk") {
+			t.Fatalf("expected the error for %q to list the log types, got %v", value, err)
+		}
+	}
+}
+
+func TestValidateLogArgsUnknownKeys(t *testing.T) {
+	err := ValidateLogArgs(SplunkLogType, `{"url": "https://splunk.example.com:8088", "tokenSecretArn": "arn:aws:secretsmanager:us-east-1:123456789012:secret:hec", "retentionDays": 7}`)
+	if err == nil || !strings.Contains(err.Error(), "retentionDays") {
+		t.Fatalf("expected the unknown key to be named, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "logType splunk") {
+		t.Fatalf("expected the error to name the log type, got %v", err)
+	}
+
+	err = ValidateLogArgs(AwsLogType, `["retentionDays"]`)
+	if err == nil {
+		t.Fatalf("expected logArgs that are not an object to fail")
+	}
+
+	if err := ValidateLogArgs(AwsLogType, ""); err != nil {
+		t.Fatalf("expected empty logArgs to use the defaults, got %v", err)
+	}
+
+	if err := ValidateLogArgs(LogType(9), ""); err == nil {
+		t.Fatalf("expected an unknown log type to fail")
+	}
+}
+
+func TestValidateLogArgsRetentionDays(t *testing.T) {
+	for _, logType := range []LogType{AwsLogType, FireLensLogType} {
+		if err := ValidateLogArgs(logType, `{"retentionDays": 14}`); err != nil {
+			t.Fatalf("unexpected error for log type %d: %v", logType, err)
+		}
+
+		err := ValidateLogArgs(logType, `{"retentionDays": 10}`)
+		if err == nil || !strings.Contains(err.Error(), "retentionDays 10") {
+			t.Fatalf("expected retentionDays 10 to be rejected for log type %d, got %v", logType, err)
+		}
+	}
+}
+
+func TestValidateLogArgsFireLensOutputs(t *testing.T) {
+	valid := []string{
+		`{}`,
+		`{"output": "cloudwatch"}`,
+		`{"output": "s3", "bucket": "logs"}`,
+		`{"output": "firehose", "deliveryStream": "logs"}`,
+		`{"output": "http", "host": "logs.example.com", "port": 443}`,
+	}
+
+	for _, jsonArgs := range valid {
+		if err := ValidateLogArgs(FireLensLogType, jsonArgs); err != nil {
+			t.Fatalf("unexpected error for %s: %v", jsonArgs, err)
+		}
+	}
+
+	invalid := map[string]string{
+		`{"output": "s3"}`:                           "bucket is required",
+		`{"output": "firehose"}`:                     "deliveryStream is required",
+		`{"output": "http", "port": 443}`:            "host is required",
+		`{"output": "http", "host": "logs.local"}`:   "port must be between 1 and 65535",
+		`{"output": "http", "host": "a", "port": 0}`: "port must be between 1 and 65535",
+		`{"output": "kafka"}`:                        "output must be",
+	}
+
+	for jsonArgs, expected := range invalid {
+		err := ValidateLogArgs(FireLensLogType, jsonArgs)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %s to fail with %q, got %v", jsonArgs, expected, err)
+		}
+	}
+}
+
+func TestValidateLogArgsSplunk(t *testing.T) {
+	if err := ValidateLogArgs(SplunkLogType, `{"url": "https://splunk.example.com:8088", "tokenSecretArn": "arn:aws:secretsmanager:us-east-1:123456789012:secret:hec"}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	invalid := map[string]string{
+		`{"tokenSecretArn": "arn:aws:secretsmanager:us-east-1:123456789012:secret:hec"}`:                                   "url must be",
+		`{"url": "splunk.example.com:8088", "tokenSecretArn": "arn:aws:secretsmanager:us-east-1:123456789012:secret:hec"}`: "url must be",
+		`{"url": "https://splunk.example.com:8088"}`:                                                                       "tokenSecretArn must be",
+	}
+
+	for jsonArgs, expected := range invalid {
+		err := ValidateLogArgs(SplunkLogType, jsonArgs)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %s to fail with %q, got %v", jsonArgs, expected, err)
+		}
+	}
+}
+
+func TestValidateNatlessLogArgs(t *testing.T) {
+	if problems := ValidateNatlessLogArgs(SplunkLogType, `{"url": "https://splunk.example.com:8088", "tokenSecretArn": "arn:aws:secretsmanager:us-east-1:123456789012:secret:hec"}`, nil); len(problems) != 1 {
+		t.Fatalf("expected splunk to be rejected in natless mode, got %v", problems)
+	}
+
+	if problems := ValidateNatlessLogArgs(AwsLogType, "", nil); len(problems) != 0 {
+		t.Fatalf("expected awslogs to be accepted in natless mode, got %v", problems)
+	}
+}
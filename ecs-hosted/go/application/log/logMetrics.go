@@ -0,0 +1,35 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+/*
+Count the lines of a log group that match each filter pattern as a CloudWatch metric, named after the filter, so alarms can be built on them.
+The metrics report 0 when nothing matches, so alarms see missing errors as healthy rather than as missing data.
+*/
+func NewLogMetricFilters(ctx *pulumi.Context, name string, logGroup *cloudwatch.LogGroup, namespace string, filters map[string]string, opts ...pulumi.ResourceOption) error {
+	for metricName, pattern := range filters {
+		_, err := cloudwatch.NewLogMetricFilter(ctx, fmt.Sprintf("%s-%s", name, metricName), &cloudwatch.LogMetricFilterArgs{
+			Name:         pulumi.String(metricName),
+			LogGroupName: logGroup.Name,
+			Pattern:      pulumi.String(pattern),
+			MetricTransformation: &cloudwatch.LogMetricFilterMetricTransformationArgs{
+				Name:         pulumi.String(metricName),
+				Namespace:    pulumi.String(namespace),
+				Value:        pulumi.String("1"),
+				DefaultValue: pulumi.String("0"),
+				Unit:         pulumi.String("Count"),
+			},
+		}, opts...)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func parseSplunkArgs(jsonArgs string) (*SplunkArgs, error) {
+	args := SplunkArgs{}
+	err := decodeLogArgs(jsonArgs, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(args.Url, "https://") && !strings.HasPrefix(args.Url, "http://") {
+		return nil, fmt.Errorf("url must be the HTTP Event Collector URL, eg- https://splunk.example.com:8088, not %q", args.Url)
+	}
+
+	if !strings.HasPrefix(args.TokenSecretArn, "arn:") {
+		return nil, fmt.Errorf("tokenSecretArn must be the ARN of the Secrets Manager secret holding the HEC token")
+	}
+
+	return &args, nil
+}
+
+// the collector is outside the VPC and the natless task security groups only allow egress to the VPC endpoints, so events could never be delivered
+func validateSplunkNatless() []string {
+	return []string{"logType splunk is not supported in natless mode; the private subnets have no route to the HTTP Event Collector"}
+}
+
+/*
+Send container logs to a Splunk HTTP Event Collector with the ECS splunk log driver.
+The HEC token is never part of the task definition; it is read from an existing Secrets Manager secret when the task starts,
+so the execution role is given access to that secret.
+*/
+func NewSplunkLogs(name string, args *SplunkArgs) (*SplunkLogs, error) {
+	statements := []map[string]any{
+		{
+			"Effect":   "Allow",
+			"Action":   []string{"secretsmanager:GetSecretValue"},
+			"Resource": []string{args.TokenSecretArn},
+		},
+	}
+
+	// secrets encrypted with a customer managed key also need the key
+	if args.TokenKmsKeyArn != "" {
+		statements = append(statements, map[string]any{
+			"Effect":   "Allow",
+			"Action":   []string{"kms:Decrypt"},
+			"Resource": []string{args.TokenKmsKeyArn},
+		})
+	}
+
+	policyDoc, err := json.Marshal(map[string]any{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	options := map[string]any{
+		"splunk-url":                args.Url,
+		"splunk-source":             name,
+		"splunk-insecureskipverify": fmt.Sprintf("%v", args.InsecureSkipVerify),
+	}
+
+	if args.Index != "" {
+		options["splunk-index"] = args.Index
+	}
+
+	if args.SourceType != "" {
+		options["splunk-sourcetype"] = args.SourceType
+	}
+
+	resource := SplunkLogs{
+		TokenSecretArn:         args.TokenSecretArn,
+		Options:                options,
+		ExecutionRolePolicyDoc: string(policyDoc),
+	}
+
+	return &resource, nil
+}
+
+func (l SplunkLogs) GetConfiguration() map[string]any {
+	return map[string]any{
+		"logDriver": "splunk",
+		"options":   l.Options,
+		"secretOptions": []map[string]any{
+			{
+				"name":      "splunk-token",
+				"valueFrom": l.TokenSecretArn,
+			},
+		},
+	}
+}
+
+// the splunk driver runs in the ECS agent; no sidecar or task role permissions are needed
+func (l SplunkLogs) GetSidecars() []map[string]any {
+	return nil
+}
+
+func (l SplunkLogs) GetTaskRolePolicyDocs() pulumi.StringArray {
+	return nil
+}
+
+func (l SplunkLogs) GetExecutionRolePolicyDocs() pulumi.StringArray {
+	return pulumi.StringArray{pulumi.String(l.ExecutionRolePolicyDoc)}
+}
+
+// events go straight to the collector
+func (l SplunkLogs) GetLogGroup() *cloudwatch.LogGroup {
+	return nil
+}
+
+type SplunkArgs struct {
+	Url                string
+	TokenSecretArn     string
+	TokenKmsKeyArn     string
+	Index              string
+	SourceType         string
+	InsecureSkipVerify bool
+}
+
+type SplunkLogs struct {
+	TokenSecretArn         string
+	Options                map[string]any
+	ExecutionRolePolicyDoc string
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/s3"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/config"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/log"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/network"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/service"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/utils"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
 	"github.com/pulumi/pulumi-tls/sdk/v5/go/tls"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
@@ -21,12 +25,20 @@ func main() {
 			return err
 		}
 
+		err = common.RegisterDefaultTags(ctx, config.Tags)
+		if err != nil {
+			return err
+		}
+
+		// nil when the infrastructure stack does not provide a customer managed key
+		dataKmsKeyArn := utils.OptionalString(config.DataKmsKeyArn)
+
 		// Pulumi uses 2 s3 buckets; checkpoints and policypacks
 		checkpointsBucket, err := s3.NewBucket(ctx, "pulumi-checkpoints", &s3.BucketArgs{}, pulumi.Protect(true))
 		if err != nil {
 			return err
 		}
-		_, err = s3.NewBucketVersioningV2(ctx, "pulumi-checkpoints-versioning", &s3.BucketVersioningV2Args{
+		checkpointsVersioning, err := s3.NewBucketVersioningV2(ctx, "pulumi-checkpoints-versioning", &s3.BucketVersioningV2Args{
 			Bucket: checkpointsBucket.ID(),
 			VersioningConfiguration: &s3.BucketVersioningV2VersioningConfigurationArgs{
 				Status: pulumi.String("Enabled"),
@@ -40,7 +52,7 @@ func main() {
 		if err != nil {
 			return err
 		}
-		_, err = s3.NewBucketVersioningV2(ctx, "pulumi-policypacks-versioning", &s3.BucketVersioningV2Args{
+		policypackVersioning, err := s3.NewBucketVersioningV2(ctx, "pulumi-policypacks-versioning", &s3.BucketVersioningV2Args{
 			Bucket: policypackBucket.ID(),
 			VersioningConfiguration: &s3.BucketVersioningV2VersioningConfigurationArgs{
 				Status: pulumi.String("Enabled"),
@@ -54,7 +66,7 @@ func main() {
 		if err != nil {
 			return err
 		}
-		_, err = s3.NewBucketVersioningV2(ctx, "pulumi-service-metadata-versioning", &s3.BucketVersioningV2Args{
+		metadataVersioning, err := s3.NewBucketVersioningV2(ctx, "pulumi-service-metadata-versioning", &s3.BucketVersioningV2Args{
 			Bucket: metadataBucket.ID(),
 			VersioningConfiguration: &s3.BucketVersioningV2VersioningConfigurationArgs{
 				Status: pulumi.String("Enabled"),
@@ -64,6 +76,27 @@ func main() {
 			return err
 		}
 
+		serviceBuckets := []serviceBucket{
+			{Name: "pulumi-checkpoints", Bucket: checkpointsBucket, Versioning: checkpointsVersioning},
+			{Name: "pulumi-policypacks", Bucket: policypackBucket, Versioning: policypackVersioning},
+			{Name: "pulumi-service-metadata", Bucket: metadataBucket, Versioning: metadataVersioning},
+		}
+
+		for _, b := range serviceBuckets {
+			err = newBucketDefaults(ctx, b.Name, b.Bucket, config.DataKmsKeyArn)
+			if err != nil {
+				return err
+			}
+		}
+
+		// replicate all service buckets to the DR region so a regional outage does not lose checkpoints or metadata
+		if config.DrRegion != "" {
+			err = newBucketReplication(ctx, "pulumi-dr", config.AwsSettings, config.DrRegion, config.DataKmsKeyArn, config.DrKmsKeyArn, serviceBuckets)
+			if err != nil {
+				return err
+			}
+		}
+
 		// retrieve "our" VPC to pull in our CIDR block which will be used for SG CIDR purpose
 		v := ec2.LookupVpcOutput(ctx, ec2.LookupVpcOutputArgs{Id: config.VpcId})
 
@@ -87,6 +120,7 @@ func main() {
 		apiUrl := strings.Join([]string{"api", config.Route53Subdomain, config.Route53ZoneName}, ".")
 		apiInternalUrl := strings.Join([]string{"api-internal", config.Route53Subdomain, config.Route53ZoneName}, ".")
 		consoleUrl := strings.Join([]string{"app", config.Route53Subdomain, config.Route53ZoneName}, ".")
+		dashboardsUrl := strings.Join([]string{"dashboards", config.Route53Subdomain, config.Route53ZoneName}, ".")
 		domain := config.Route53ZoneName
 
 		// generally our URLs end up something like app/api.sub-domain.domain.com
@@ -96,6 +130,7 @@ func main() {
 			apiUrl = strings.Join([]string{"api", config.Route53ZoneName}, ".")
 			apiInternalUrl = strings.Join([]string{"api-internal", config.Route53ZoneName}, ".")
 			consoleUrl = strings.Join([]string{"app", config.Route53ZoneName}, ".")
+			dashboardsUrl = strings.Join([]string{"dashboards", config.Route53ZoneName}, ".")
 		}
 
 		if err != nil {
@@ -106,7 +141,9 @@ func main() {
 		baseArgs := &service.ContainerBaseArgs{
 			AccountId:                               config.AccountId,
 			CertificateArn:                          config.AcmCertificateArn,
+			DataKmsKeyArn:                           config.DataKmsKeyArn,
 			EnablePrivateLoadBalancerAndLimitEgress: config.EnablePrivateLoadBalancerAndLimitEgress,
+			EnableNatlessMode:                       config.EnableNatlessMode,
 			KmsServiceKeyId:                         config.KmsServiceKeyId,
 			Profile:                                 config.Profile,
 			PrefixListId:                            config.PrefixListId,
@@ -129,8 +166,12 @@ func main() {
 
 		// logs will be created based on configuration
 		// could be awslogs, firelens, etc
-		apiLogs := log.NewLogs(ctx, config.LogType, "pulumi-api", config.Region, config.LogArgs)
-		_, err = service.NewApiContainerService(ctx, "pulumi-api", &service.ApiContainerServiceArgs{
+		apiLogs, err := log.NewLogs(ctx, config.LogType, "pulumi-api", config.Region, dataKmsKeyArn, config.LogArgs)
+		if err != nil {
+			return err
+		}
+
+		apiService, err := service.NewApiContainerService(ctx, "pulumi-api", &service.ApiContainerServiceArgs{
 			ApiUrl:                     apiUrl,
 			CheckPointbucket:           checkpointsBucket,
 			ConsoleUrl:                 consoleUrl,
@@ -158,10 +199,15 @@ func main() {
 			TrafficManager:             trafficManager,
 			WhiteListCidrBlocks:        config.WhiteListCidrBlocks,
 			HasOpenSearch:              config.HasOpenSearch,
+			UseOpenSearchServerless:    config.UseOpenSearchServerless,
 			OpenSearchUser:             config.OpenSearchUser,
 			OpenSearchPassword:         config.OpenSearchPassword,
 			OpenSearchDomainName:       config.OpenSearchDomainName,
 			OpenSearchEndpoint:         config.OpenSearchEndpoint,
+			ApiTaskRoleName:            config.ApiTaskRoleName,
+			ApiTaskRoleArn:             config.ApiTaskRoleArn,
+			ApiSecurityGroupId:         config.ApiSecurityGroupId,
+			OpenSearchIamMasterUser:    config.OpenSearchIamMasterUser,
 			EngineEventsSchemaV2:       config.ApiEngineEventsSchemaV2,
 			EngineEventsLegacyWrite:    config.ApiEngineEventsLegacyWrite,
 		})
@@ -170,7 +216,11 @@ func main() {
 			return err
 		}
 
-		consoleLogs := log.NewLogs(ctx, config.LogType, "pulumi-ui", config.Region, config.LogArgs)
+		consoleLogs, err := log.NewLogs(ctx, config.LogType, "pulumi-ui", config.Region, dataKmsKeyArn, config.LogArgs)
+		if err != nil {
+			return err
+		}
+
 		_, err = service.NewConsoleContainerService(ctx, "pulumi-ui", &service.ConsoleContainerServiceArgs{
 			ApiUrl:                     apiUrl,
 			ApiInternalUrl:             apiInternalUrl,
@@ -199,6 +249,81 @@ func main() {
 			return err
 		}
 
+		if config.EnableOpenSearchDashboards {
+			dashboardsLogs, err := log.NewLogs(ctx, config.LogType, "pulumi-dashboards", config.Region, dataKmsKeyArn, config.LogArgs)
+			if err != nil {
+				return err
+			}
+
+			_, err = service.DeployOpenSearchDashboards(ctx, "pulumi-dashboards", &service.OpenSearchDashboardsServiceArgs{
+				ContainerBaseArgs:  *baseArgs,
+				DashboardsUrl:      dashboardsUrl,
+				Image:              config.OpenSearchDashboardsImage,
+				LogDriver:          dashboardsLogs,
+				OpenSearchEndpoint: config.OpenSearchEndpoint,
+				OpenSearchUser:     config.OpenSearchUser,
+				OpenSearchPassword: config.OpenSearchPassword,
+				SecurityGroupId:    config.ApiSecurityGroupId,
+				TaskMemory:         config.OpenSearchDashboardsMemory,
+				TaskCpu:            config.OpenSearchDashboardsCpu,
+				TrafficManager:     trafficManager,
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		// logs are archived to S3 so they outlive the log groups' retention
+		if config.EnableLogArchive {
+			archive, err := log.NewLogArchive(ctx, "pulumi-log-archive", &log.LogArchiveArgs{
+				Region:         config.Region,
+				AccountId:      config.AccountId,
+				KmsKeyArn:      config.DataKmsKeyArn,
+				FilterPattern:  config.LogArchiveFilterPattern,
+				ExpirationDays: config.LogArchiveExpirationDays,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			archivedLogGroups := []struct {
+				Name     string
+				LogGroup *cloudwatch.LogGroup
+			}{
+				{Name: "pulumi-api", LogGroup: apiLogs.GetLogGroup()},
+				{Name: "pulumi-ui", LogGroup: consoleLogs.GetLogGroup()},
+				{Name: "pulumi-api-migrations", LogGroup: apiService.Migrations.LogGroup},
+			}
+
+			for _, lg := range archivedLogGroups {
+				if lg.LogGroup == nil {
+					return fmt.Errorf("enableLogArchive needs the %s logs in CloudWatch; use logType awslogs or firelens with the cloudwatch output", lg.Name)
+				}
+
+				err = archive.Subscribe(ctx, lg.Name, lg.LogGroup)
+				if err != nil {
+					return err
+				}
+			}
+
+			ctx.Export("logArchiveS3BucketName", archive.Bucket.Bucket)
+		}
+
+		// API error lines are counted as CloudWatch metrics for alerting
+		if config.EnableLogMetrics {
+			apiLogGroup := apiLogs.GetLogGroup()
+			if apiLogGroup == nil {
+				return fmt.Errorf("enableLogMetrics needs the pulumi-api logs in CloudWatch; use logType awslogs or firelens with the cloudwatch output")
+			}
+
+			err = log.NewLogMetricFilters(ctx, "pulumi-api-metrics", apiLogGroup, config.LogMetricNamespace, config.LogMetricFilters)
+			if err != nil {
+				return err
+			}
+		}
+
 		ctx.Export("checkpointsS3BucketName", checkpointsBucket.Bucket)
 		ctx.Export("policyPacksS3BucketName", policypackBucket.Bucket)
 		ctx.Export("metadataS3BucketName", metadataBucket.Bucket)
@@ -220,6 +345,43 @@ func main() {
 	})
 }
 
+// Block public access to a service bucket and encrypt it by default; SSE-KMS with the given key when one is provided, otherwise SSE-S3
+func newBucketDefaults(ctx *pulumi.Context, name string, bucket *s3.Bucket, kmsKeyArn pulumi.StringOutput, opts ...pulumi.ResourceOption) error {
+	_, err := s3.NewBucketPublicAccessBlock(ctx, fmt.Sprintf("%s-public-access", name), &s3.BucketPublicAccessBlockArgs{
+		Bucket:                bucket.ID(),
+		BlockPublicAcls:       pulumi.Bool(true),
+		BlockPublicPolicy:     pulumi.Bool(true),
+		IgnorePublicAcls:      pulumi.Bool(true),
+		RestrictPublicBuckets: pulumi.Bool(true),
+	}, opts...)
+
+	if err != nil {
+		return err
+	}
+
+	algorithm := kmsKeyArn.ApplyT(func(arn string) string {
+		if arn == "" {
+			return "AES256"
+		}
+		return "aws:kms"
+	}).(pulumi.StringOutput)
+
+	_, err = s3.NewBucketServerSideEncryptionConfigurationV2(ctx, fmt.Sprintf("%s-encryption", name), &s3.BucketServerSideEncryptionConfigurationV2Args{
+		Bucket: bucket.ID(),
+		Rules: s3.BucketServerSideEncryptionConfigurationV2RuleArray{
+			&s3.BucketServerSideEncryptionConfigurationV2RuleArgs{
+				ApplyServerSideEncryptionByDefault: &s3.BucketServerSideEncryptionConfigurationV2RuleApplyServerSideEncryptionByDefaultArgs{
+					SseAlgorithm:   algorithm,
+					KmsMasterKeyId: utils.OptionalString(kmsKeyArn),
+				},
+				BucketKeyEnabled: pulumi.Bool(true),
+			},
+		},
+	}, opts...)
+
+	return err
+}
+
 // Create a private and public certificate used to enable SAML SSO authentication
 func createSamlCerts(ctx *pulumi.Context, config *config.ConfigArgs, apiUrl string) error {
 	privateKey, err := tls.NewPrivateKey(ctx, "sso-key", &tls.PrivateKeyArgs{
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/s3"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Create a versioned replica of each bucket in the DR region and replicate all objects, including deletes, to it.
+// Objects encrypted with the source data key are re-encrypted with the DR key, which config requires whenever the data key is in use.
+func newBucketReplication(ctx *pulumi.Context, name string, awsSettings *common.AwsSettings, drRegion string, sourceKmsKeyArn pulumi.StringOutput, drKmsKeyArn string, buckets []serviceBucket, opts ...pulumi.ResourceOption) error {
+	// the DR provider authenticates with the same aws: settings as the primary region
+	provider, err := aws.NewProvider(ctx, fmt.Sprintf("%s-provider", name), common.NewRegionalProviderArgs(awsSettings, drRegion), opts...)
+	if err != nil {
+		return err
+	}
+
+	drOptions := append(opts, pulumi.Provider(provider))
+
+	role, err := iam.NewRole(ctx, fmt.Sprintf("%s-replication-role", name), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Sid": "",
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "s3.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}]
+		}`),
+	}, opts...)
+
+	if err != nil {
+		return err
+	}
+
+	var sourceSelectionCriteria s3.BucketReplicationConfigRuleSourceSelectionCriteriaPtrInput
+	var encryptionConfiguration s3.BucketReplicationConfigRuleDestinationEncryptionConfigurationPtrInput
+	if drKmsKeyArn != "" {
+		sourceSelectionCriteria = &s3.BucketReplicationConfigRuleSourceSelectionCriteriaArgs{
+			SseKmsEncryptedObjects: &s3.BucketReplicationConfigRuleSourceSelectionCriteriaSseKmsEncryptedObjectsArgs{
+				Status: pulumi.String("Enabled"),
+			},
+		}
+		encryptionConfiguration = &s3.BucketReplicationConfigRuleDestinationEncryptionConfigurationArgs{
+			ReplicaKmsKeyId: pulumi.String(drKmsKeyArn),
+		}
+	}
+
+	var bucketArns []any
+	for _, b := range buckets {
+		replica, err := s3.NewBucket(ctx, fmt.Sprintf("%s-replica", b.Name), &s3.BucketArgs{}, append(drOptions, pulumi.Protect(true))...)
+		if err != nil {
+			return err
+		}
+
+		// the replica gets the same defaults as its source, with the DR key standing in for the data key
+		err = newBucketDefaults(ctx, fmt.Sprintf("%s-replica", b.Name), replica, pulumi.String(drKmsKeyArn).ToStringOutput(), drOptions...)
+		if err != nil {
+			return err
+		}
+
+		replicaVersioning, err := s3.NewBucketVersioningV2(ctx, fmt.Sprintf("%s-replica-versioning", b.Name), &s3.BucketVersioningV2Args{
+			Bucket: replica.ID(),
+			VersioningConfiguration: &s3.BucketVersioningV2VersioningConfigurationArgs{
+				Status: pulumi.String("Enabled"),
+			},
+		}, drOptions...)
+
+		if err != nil {
+			return err
+		}
+
+		// replication requires versioning on both source and destination
+		replicationOpts := append(opts, pulumi.DependsOn([]pulumi.Resource{b.Versioning, replicaVersioning}))
+		_, err = s3.NewBucketReplicationConfig(ctx, fmt.Sprintf("%s-replication", b.Name), &s3.BucketReplicationConfigArgs{
+			Bucket: b.Bucket.ID(),
+			Role:   role.Arn,
+			Rules: s3.BucketReplicationConfigRuleArray{
+				&s3.BucketReplicationConfigRuleArgs{
+					Id:     pulumi.String("disaster-recovery"),
+					Status: pulumi.String("Enabled"),
+					Filter: &s3.BucketReplicationConfigRuleFilterArgs{},
+					DeleteMarkerReplication: &s3.BucketReplicationConfigRuleDeleteMarkerReplicationArgs{
+						Status: pulumi.String("Enabled"),
+					},
+					SourceSelectionCriteria: sourceSelectionCriteria,
+					Destination: &s3.BucketReplicationConfigRuleDestinationArgs{
+						Bucket:                  replica.Arn,
+						StorageClass:            pulumi.String("STANDARD"),
+						EncryptionConfiguration: encryptionConfiguration,
+					},
+				},
+			},
+		}, replicationOpts...)
+
+		if err != nil {
+			return err
+		}
+
+		bucketArns = append(bucketArns, b.Bucket.Arn, replica.Arn)
+	}
+
+	policy := pulumi.All(append([]any{sourceKmsKeyArn}, bucketArns...)...).ApplyT(func(applyArgs []any) (string, error) {
+		sourceKeyArn := applyArgs[0].(string)
+		arns := applyArgs[1:]
+
+		var sources, sourceObjects, destinationObjects []string
+		for i := 0; i < len(arns); i += 2 {
+			sources = append(sources, arns[i].(string))
+			sourceObjects = append(sourceObjects, fmt.Sprintf("%s/*", arns[i]))
+			destinationObjects = append(destinationObjects, fmt.Sprintf("%s/*", arns[i+1]))
+		}
+
+		statements := []map[string]any{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:GetReplicationConfiguration", "s3:ListBucket"},
+				"Resource": sources,
+			},
+			{
+				"Effect": "Allow",
+				"Action": []string{
+					"s3:GetObjectVersionForReplication",
+					"s3:GetObjectVersionAcl",
+					"s3:GetObjectVersionTagging",
+				},
+				"Resource": sourceObjects,
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:ReplicateObject", "s3:ReplicateDelete", "s3:ReplicateTags"},
+				"Resource": destinationObjects,
+			},
+		}
+
+		if drKmsKeyArn != "" {
+			if sourceKeyArn != "" {
+				statements = append(statements, map[string]any{
+					"Effect":   "Allow",
+					"Action":   []string{"kms:Decrypt"},
+					"Resource": []string{sourceKeyArn},
+				})
+			}
+
+			statements = append(statements, map[string]any{
+				"Effect":   "Allow",
+				"Action":   []string{"kms:Encrypt", "kms:GenerateDataKey"},
+				"Resource": []string{drKmsKeyArn},
+			})
+		}
+
+		policyDoc, err := json.Marshal(map[string]any{
+			"Version":   "2012-10-17",
+			"Statement": statements,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(policyDoc), nil
+	}).(pulumi.StringOutput)
+
+	_, err = iam.NewRolePolicy(ctx, fmt.Sprintf("%s-replication-pol", name), &iam.RolePolicyArgs{
+		Role:   role.ID(),
+		Policy: policy,
+	}, opts...)
+
+	return err
+}
+
+type serviceBucket struct {
+	Name       string
+	Bucket     *s3.Bucket
+	Versioning *s3.BucketVersioningV2
+}
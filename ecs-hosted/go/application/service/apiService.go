@@ -7,6 +7,7 @@ import (
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/kms"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/lb"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/opensearch"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/s3"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/config"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/log"
@@ -47,16 +48,7 @@ func NewApiContainerService(ctx *pulumi.Context, name string, args *ApiContainer
 	}
 
 	// secrets file
-	secretValues := []Secret{
-		{
-			Name:  "PULUMI_DATABASE_USER_NAME",
-			Value: args.DatabaseArgs.Username,
-		},
-		{
-			Name:  "PULUMI_DATABASE_USER_PASSWORD",
-			Value: args.DatabaseArgs.Password,
-		},
-	}
+	var secretValues []Secret
 
 	if args.RecaptchaSecretKey != "" {
 		secretValues = append(secretValues, Secret{
@@ -65,7 +57,8 @@ func NewApiContainerService(ctx *pulumi.Context, name string, args *ApiContainer
 		})
 	}
 
-	if args.HasOpenSearch {
+	// a serverless collection, and the managed domain with the API role as master user, have no admin user; requests are signed with the task role instead
+	if args.HasOpenSearch && !args.UseOpenSearchServerless && !args.OpenSearchIamMasterUser {
 		secretValues = append(secretValues, Secret{
 			Name:  "PULUMI_SEARCH_PASSWORD",
 			Value: args.OpenSearchPassword,
@@ -92,6 +85,19 @@ func NewApiContainerService(ctx *pulumi.Context, name string, args *ApiContainer
 		Prefix:   args.SecretsManagerPrefix,
 		KmsKeyId: args.KmsServiceKeyId,
 		Secrets:  secretValues,
+		// database credentials are read straight from the Aurora managed secret so rotated passwords are picked up on task start
+		References: []SecretReference{
+			{
+				Name:      "PULUMI_DATABASE_USER_NAME",
+				SecretArn: args.DatabaseArgs.CredentialsSecretArn,
+				JsonKey:   "username",
+			},
+			{
+				Name:      "PULUMI_DATABASE_USER_PASSWORD",
+				SecretArn: args.DatabaseArgs.CredentialsSecretArn,
+				JsonKey:   "password",
+			},
+		},
 	}, options...)
 
 	if err != nil {
@@ -199,6 +205,17 @@ func NewApiContainerService(ctx *pulumi.Context, name string, args *ApiContainer
 		},
 	}
 
+	serviceSgEgressRules := dbSgEgressRules
+	if args.HasOpenSearch {
+		serviceSgEgressRules = append(newOpenSearchEgressRules(&args.ContainerBaseArgs), serviceSgEgressRules...)
+	}
+
+	// the managed domain only admits the security group the infrastructure stack created for the API, and grants its role access
+	var searchSecurityGroupIds pulumi.StringArray
+	if args.ApiSecurityGroupId != "" {
+		searchSecurityGroupIds = pulumi.StringArray{pulumi.String(args.ApiSecurityGroupId)}
+	}
+
 	resource.ContainerService, err = NewContainerService(ctx, name, &ContainerServiceArgs{
 		ContainerBaseArgs:          args.ContainerBaseArgs,
 		TargetGroups:               serviceTgs,
@@ -206,13 +223,36 @@ func NewApiContainerService(ctx *pulumi.Context, name string, args *ApiContainer
 		PulumiInternalLoadBalancer: args.TrafficManager.Internal,
 		TargetPort:                 apiPort,
 		TaskDefinitionArgs:         taskArgs,
-		SecurityGroupEgressRules:   dbSgEgressRules,
+		SecurityGroupEgressRules:   serviceSgEgressRules,
+		SecurityGroupIds:           searchSecurityGroupIds,
+		TaskRoleName:               args.ApiTaskRoleName,
+		TaskRoleArn:                args.ApiTaskRoleArn,
 	}, serviceOptions...)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if args.UseOpenSearchServerless {
+		// only the API task role may read and write the collection's indexes
+		accessPolicy := pulumi.All(args.OpenSearchDomainName, resource.ContainerService.TaskRoleArn).ApplyT(func(applyArgs []any) (string, error) {
+			doc, err := json.Marshal(common.OpenSearchDataAccessPolicy(applyArgs[0].(string), []string{applyArgs[1].(string)}))
+			return string(doc), err
+		}).(pulumi.StringOutput)
+
+		_, err = opensearch.NewServerlessAccessPolicy(ctx, fmt.Sprintf("%s-search-access", name), &opensearch.ServerlessAccessPolicyArgs{
+			Name: args.OpenSearchDomainName.ApplyT(func(collection string) string {
+				return fmt.Sprintf("%s-api", collection)
+			}).(pulumi.StringOutput),
+			Type:   pulumi.String("data"),
+			Policy: accessPolicy,
+		}, options...)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Allow access out of ALBs SG to ECS SG
 	_, err = ec2.NewSecurityGroupRule(ctx, fmt.Sprintf("%s-alb-to-ecs-rule", name), &ec2.SecurityGroupRuleArgs{
 		Type:                  pulumi.String("egress"),
@@ -242,7 +282,7 @@ func NewApiContainerService(ctx *pulumi.Context, name string, args *ApiContainer
 		return nil, err
 	}
 
-	_, err = NewMigrationsService(ctx, fmt.Sprintf("%s-migrations", name), &MigrationsContainerServiceArgs{
+	resource.Migrations, err = NewMigrationsService(ctx, fmt.Sprintf("%s-migrations", name), &MigrationsContainerServiceArgs{
 		ContainerBaseArgs:        args.ContainerBaseArgs,
 		DatabaseArgs:             args.DatabaseArgs,
 		EcrRepoAccountId:         args.EcrRepoAccountId,
@@ -294,8 +334,16 @@ func newApiTaskArgs(ctx *pulumi.Context, args *ApiContainerServiceArgs, secrets
 	imageName := fmt.Sprintf("pulumi/service:%s", args.ImageTag)
 	fullQualifiedImage := utils.NewEcrImageTag(ecrAccountId, args.Region, imageName, args.ImagePrefix)
 
+	// API tasks connect through RDS Proxy when the infrastructure stack provides one
+	dbEndpoint := pulumi.All(args.DatabaseArgs.ClusterEndpoint, args.DatabaseArgs.ProxyEndpoint).ApplyT(func(applyArgs []any) string {
+		if proxyEndpoint := applyArgs[1].(string); proxyEndpoint != "" {
+			return proxyEndpoint
+		}
+		return applyArgs[0].(string)
+	}).(pulumi.StringOutput)
+
 	inputs := []any{
-		args.DatabaseArgs.ClusterEndpoint,
+		dbEndpoint,
 		args.DatabaseArgs.Port,
 		secrets.Secrets,
 		args.CheckPointbucket.Bucket,
@@ -304,6 +352,7 @@ func newApiTaskArgs(ctx *pulumi.Context, args *ApiContainerServiceArgs, secrets
 		args.LogDriver,
 		args.OpenSearchUser,
 		args.OpenSearchEndpoint,
+		args.DatabaseArgs.Name,
 	}
 
 	if args.SamlArgs.Enabled {
@@ -324,6 +373,7 @@ func newApiTaskArgs(ctx *pulumi.Context, args *ApiContainerServiceArgs, secrets
 		logDriver := applyArgs[6].(log.LogDriver)
 		OpenSearchUser := applyArgs[7].(string)
 		OpenSearchEndpoint := applyArgs[8].(string)
+		dbName := applyArgs[9].(string)
 
 		samlCertPublicKey := ""
 		if len(inputs) > 7 {
@@ -334,6 +384,7 @@ func newApiTaskArgs(ctx *pulumi.Context, args *ApiContainerServiceArgs, secrets
 			ApiContainerArgs:   args,
 			DbEndpoint:         dbEndpoint,
 			DbPort:             dbPort,
+			DbName:             dbName,
 			CheckPointBucket:   checkpointBucket,
 			PolicyPackBucket:   policypackBucket,
 			MetadataBucket:     metadataBucket,
@@ -342,29 +393,27 @@ func newApiTaskArgs(ctx *pulumi.Context, args *ApiContainerServiceArgs, secrets
 			OpenSearchEndpoint: OpenSearchEndpoint,
 		}
 
-		containerJson, err := json.Marshal([]any{
-			map[string]any{
-				"cpu":               containerCpu,
-				"environment":       newApiEnvironmentVariables(*envArgs),
-				"image":             fullQualifiedImage,
-				"logConfiguration":  logDriver.GetConfiguration(),
-				"memoryReservation": containerMemoryRes,
-				"name":              apiContainerName,
-				"portMappings": []map[string]any{
-					{
-						"containerPort": apiPort,
-					},
+		containerJson, err := json.Marshal(withLogSidecars(map[string]any{
+			"cpu":               containerCpu,
+			"environment":       newApiEnvironmentVariables(*envArgs),
+			"image":             fullQualifiedImage,
+			"logConfiguration":  logDriver.GetConfiguration(),
+			"memoryReservation": containerMemoryRes,
+			"name":              apiContainerName,
+			"portMappings": []map[string]any{
+				{
+					"containerPort": apiPort,
 				},
-				"secrets": secretsOutput,
-				"ulimits": []map[string]any{
-					{
-						"softLimit": 100000,
-						"hardLimit": 200000,
-						"name":      "nofile",
-					},
+			},
+			"secrets": secretsOutput,
+			"ulimits": []map[string]any{
+				{
+					"softLimit": 100000,
+					"hardLimit": 200000,
+					"name":      "nofile",
 				},
 			},
-		})
+		}, logDriver))
 
 		if err != nil {
 			return "", err
@@ -373,32 +422,44 @@ func newApiTaskArgs(ctx *pulumi.Context, args *ApiContainerServiceArgs, secrets
 		return string(containerJson), nil
 	}).(pulumi.StringOutput)
 
-	s3AccessPolicyDoc := pulumi.All(args.CheckPointbucket.Bucket, args.PolicyPacksBucket.Bucket, args.MetadataBucket.Bucket).ApplyT(func(applyArgs []any) (string, error) {
+	s3AccessPolicyDoc := pulumi.All(args.CheckPointbucket.Bucket, args.PolicyPacksBucket.Bucket, args.MetadataBucket.Bucket, args.DataKmsKeyArn).ApplyT(func(applyArgs []any) (string, error) {
 
 		checkpointBucket := applyArgs[0].(string)
 		policypackBucket := applyArgs[1].(string)
 		metadataBucket := applyArgs[2].(string)
+		dataKmsKeyArn := applyArgs[3].(string)
 
 		checkpointBucketArn := common.GetIamPolicyArn(args.Region, fmt.Sprintf("arn:aws:s3:::%s", checkpointBucket))
 		policypackBucketArn := common.GetIamPolicyArn(args.Region, fmt.Sprintf("arn:aws:s3:::%s", policypackBucket))
 		metadataBucketArn := common.GetIamPolicyArn(args.Region, fmt.Sprintf("arn:aws:s3:::%s", metadataBucket))
 
-		policyDoc, err := json.Marshal(map[string]any{
-			"Version": "2012-10-17",
-			"Statement": []map[string]any{
-				{
-					"Effect": "Allow",
-					"Action": []string{"s3:*"},
-					"Resource": []string{
-						checkpointBucketArn,
-						fmt.Sprintf("%s/*", checkpointBucketArn),
-						policypackBucketArn,
-						fmt.Sprintf("%s/*", policypackBucketArn),
-						metadataBucketArn,
-						fmt.Sprintf("%s/*", metadataBucketArn),
-					},
+		statements := []map[string]any{
+			{
+				"Effect": "Allow",
+				"Action": []string{"s3:*"},
+				"Resource": []string{
+					checkpointBucketArn,
+					fmt.Sprintf("%s/*", checkpointBucketArn),
+					policypackBucketArn,
+					fmt.Sprintf("%s/*", policypackBucketArn),
+					metadataBucketArn,
+					fmt.Sprintf("%s/*", metadataBucketArn),
 				},
 			},
+		}
+
+		// buckets encrypted with the customer managed data key require the service to use that key for reads and writes
+		if dataKmsKeyArn != "" {
+			statements = append(statements, map[string]any{
+				"Effect":   "Allow",
+				"Action":   []string{"kms:Decrypt", "kms:GenerateDataKey"},
+				"Resource": []string{dataKmsKeyArn},
+			})
+		}
+
+		policyDoc, err := json.Marshal(map[string]any{
+			"Version":   "2012-10-17",
+			"Statement": statements,
 		})
 
 		if err != nil {
@@ -440,14 +501,41 @@ func newApiTaskArgs(ctx *pulumi.Context, args *ApiContainerServiceArgs, secrets
 		return nil, err
 	}
 
+	taskRolePolicyDocs := pulumi.StringArray{s3AccessPolicyDoc, kmsPolicyDoc}
+
+	// IAM only lets the role call OpenSearch Serverless; the data access policy decides which collection and indexes
+	if args.UseOpenSearchServerless {
+		collectionArn := common.GetIamPolicyArn(args.Region, fmt.Sprintf("arn:aws:aoss:%s:%s:collection/*", args.Region, args.AccountId))
+		searchDoc, err := json.Marshal(map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []map[string]any{
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"aoss:APIAccessAll"},
+					"Resource": []string{collectionArn},
+				},
+			},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		taskRolePolicyDocs = append(taskRolePolicyDocs, pulumi.String(string(searchDoc)))
+	}
+
 	return &TaskDefinitionArgs{
 		ContainerDefinitions: conatinerDefinitions,
-		TaskRolePolicyDocs:   pulumi.StringArray{s3AccessPolicyDoc, kmsPolicyDoc},
-		NumberDesiredTasks:   numberDesiredTasks,
-		Cpu:                  taskCpu,
-		Memory:               taskMemory,
-		ContainerName:        apiContainerName,
-		ContainerPort:        apiPort,
+		TaskRolePolicyDocs:   taskRolePolicyDocs,
+		LogDriver:            args.LogDriver,
+		ExecutionRolePolicyDocs: pulumi.StringArray{
+			NewDatabaseSecretPolicy(args.DatabaseArgs.CredentialsSecretArn, args.DataKmsKeyArn, args.DatabaseArgs.CredentialsKmsKeyArn),
+		},
+		NumberDesiredTasks: numberDesiredTasks,
+		Cpu:                taskCpu,
+		Memory:             taskMemory,
+		ContainerName:      apiContainerName,
+		ContainerPort:      apiPort,
 	}, nil
 }
 
@@ -459,7 +547,7 @@ func newApiEnvironmentVariables(environmentArgs ApiContainerEnvironment) []map[s
 		CreateEnvVar("PULUMI_ENTERPRISE", "true"),
 		CreateEnvVar("PULUMI_DATABASE_ENDPOINT", fmt.Sprintf("%s:%d", environmentArgs.DbEndpoint, environmentArgs.DbPort)),
 		CreateEnvVar("PULUMI_DATABASE_PING_ENDPOINT", environmentArgs.DbEndpoint),
-		CreateEnvVar("PULUMI_DATABASE_NAME", "pulumi"),
+		CreateEnvVar("PULUMI_DATABASE_NAME", environmentArgs.DbName),
 		CreateEnvVar("PULUMI_API_DOMAIN", args.ApiUrl),
 		CreateEnvVar("PULUMI_CONSOLE_DOMAIN", args.ConsoleUrl),
 		CreateEnvVar("PULUMI_CHECKPOINT_BLOB_STORAGE_ENDPOINT", "s3://"+environmentArgs.CheckPointBucket),
@@ -532,22 +620,29 @@ type ApiContainerServiceArgs struct {
 	MetadataBucket             *s3.Bucket
 	ExecuteMigrations          bool
 	HasOpenSearch              bool
+	UseOpenSearchServerless    bool
 	OpenSearchUser             pulumi.StringOutput
 	OpenSearchPassword         pulumi.StringOutput
 	OpenSearchDomainName       pulumi.StringOutput
 	OpenSearchEndpoint         pulumi.StringOutput
+	ApiTaskRoleName            string
+	ApiTaskRoleArn             string
+	ApiSecurityGroupId         string
+	OpenSearchIamMasterUser    bool
 }
 
 type ApiContainerService struct {
 	pulumi.ResourceState
 
 	ContainerService *ContainerService
+	Migrations       *MigrationsContainerService
 }
 
 type ApiContainerEnvironment struct {
 	ApiContainerArgs   *ApiContainerServiceArgs
 	DbEndpoint         string
 	DbPort             int
+	DbName             string
 	CheckPointBucket   string
 	PolicyPackBucket   string
 	MetadataBucket     string
@@ -77,6 +77,20 @@ func NewConsoleContainerService(ctx *pulumi.Context, name string, args *ConsoleC
 		return nil, err
 	}
 
+	// the internal NLB has no security group of its own, so the console's calls to the API can only be scoped to the VPC CIDR
+	var egressRules ec2.SecurityGroupEgressArray
+	if args.EnableNatlessMode {
+		egressRules = ec2.SecurityGroupEgressArray{
+			ec2.SecurityGroupEgressArgs{
+				FromPort:    pulumi.Int(443),
+				ToPort:      pulumi.Int(443),
+				Protocol:    pulumi.String("TCP"),
+				CidrBlocks:  pulumi.StringArray{args.VpcCidrBlock},
+				Description: pulumi.String("Allow egress from console to the API internal load balancer"),
+			},
+		}
+	}
+
 	serviceOptions := append(options, pulumi.DependsOn([]pulumi.Resource{httpsListener, httpListener}))
 	resource.ContainerService, err = NewContainerService(ctx, name, &ContainerServiceArgs{
 		ContainerBaseArgs:          args.ContainerBaseArgs,
@@ -85,6 +99,7 @@ func NewConsoleContainerService(ctx *pulumi.Context, name string, args *ConsoleC
 		TargetPort:                 consolePort,
 		TaskDefinitionArgs:         taskArgs,
 		TargetGroups:               []*lb.TargetGroup{tg},
+		SecurityGroupEgressRules:   egressRules,
 	}, serviceOptions...)
 
 	if err != nil {
@@ -156,21 +171,19 @@ func newConsoleTaskArgs(ctx *pulumi.Context, args *ConsoleContainerServiceArgs)
 		dnsName := applyArgs[0].(string)
 		logDriver := applyArgs[1].(log.LogDriver)
 
-		containerJson, err := json.Marshal([]any{
-			map[string]any{
-				"cpu":               containerCpu,
-				"environment":       newConsoleEnvironmentVariables(args, dnsName),
-				"image":             fullQualifiedImage,
-				"logConfiguration":  logDriver.GetConfiguration(),
-				"memoryReservation": containerMemoryRes,
-				"name":              consoleContainerName,
-				"portMappings": []map[string]any{
-					{
-						"containerPort": consolePort,
-					},
+		containerJson, err := json.Marshal(withLogSidecars(map[string]any{
+			"cpu":               containerCpu,
+			"environment":       newConsoleEnvironmentVariables(args, dnsName),
+			"image":             fullQualifiedImage,
+			"logConfiguration":  logDriver.GetConfiguration(),
+			"memoryReservation": containerMemoryRes,
+			"name":              consoleContainerName,
+			"portMappings": []map[string]any{
+				{
+					"containerPort": consolePort,
 				},
 			},
-		})
+		}, logDriver))
 
 		if err != nil {
 			return "", err
@@ -181,6 +194,7 @@ func newConsoleTaskArgs(ctx *pulumi.Context, args *ConsoleContainerServiceArgs)
 
 	return &TaskDefinitionArgs{
 		ContainerDefinitions: conatinerDefinitions,
+		LogDriver:            args.LogDriver,
 		NumberDesiredTasks:   numberDesiredTasks,
 		Cpu:                  taskCpu,
 		Memory:               taskMemory,
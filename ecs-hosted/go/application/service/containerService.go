@@ -1,7 +1,9 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
 
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/appautoscaling"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
@@ -9,6 +11,7 @@ import (
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/kms"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/lb"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/log"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/network"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
@@ -51,9 +54,17 @@ func NewContainerService(ctx *pulumi.Context, name string, args *ContainerServic
 		return nil, err
 	}
 
+	// the log driver may need the execution role to read a secret, eg- a Splunk HEC token, and the task role to deliver logs
+	executionRolePolicyDocs := append(pulumi.StringArray{}, args.TaskDefinitionArgs.ExecutionRolePolicyDocs...)
+	taskRolePolicyDocs := append(pulumi.StringArray{}, args.TaskDefinitionArgs.TaskRolePolicyDocs...)
+	if args.TaskDefinitionArgs.LogDriver != nil {
+		executionRolePolicyDocs = append(executionRolePolicyDocs, args.TaskDefinitionArgs.LogDriver.GetExecutionRolePolicyDocs()...)
+		taskRolePolicyDocs = append(taskRolePolicyDocs, args.TaskDefinitionArgs.LogDriver.GetTaskRolePolicyDocs()...)
+	}
+
 	// execution role will be provided to ECS for things like pulling ECR images, sending Cloudwatch logs, etc
 	// this is not the role that will be provided to the actual application
-	executionRole, err := NewEcsRole(ctx, fmt.Sprintf("%s-exeuction", name), args.Region, args.TaskDefinitionArgs.ExecutionRolePolicyDocs, options...)
+	executionRole, err := NewEcsRole(ctx, fmt.Sprintf("%s-exeuction", name), args.Region, executionRolePolicyDocs, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -77,9 +88,21 @@ func NewContainerService(ctx *pulumi.Context, name string, args *ContainerServic
 	}
 
 	// task role is given to the actual application. User code will utilize this for tasks like interacting with S3 buckets, Secrets Manager, etc
-	taskRole, err := NewEcsRole(ctx, fmt.Sprintf("%s-task", name), args.Region, args.TaskDefinitionArgs.TaskRolePolicyDocs, options...)
-	if err != nil {
-		return nil, err
+	// a caller may provide an existing role, eg- one another stack's resources trust; the task policies are attached to it instead
+	if args.TaskRoleName != "" {
+		err = attachEcsRolePolicies(ctx, fmt.Sprintf("%s-task", name), args.Region, pulumi.String(args.TaskRoleName), taskRolePolicyDocs, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		resource.TaskRoleArn = pulumi.String(args.TaskRoleArn).ToStringOutput()
+	} else {
+		taskRole, err := NewEcsRole(ctx, fmt.Sprintf("%s-task", name), args.Region, taskRolePolicyDocs, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		resource.TaskRoleArn = taskRole.Arn
 	}
 
 	taskDefinition, err := ecs.NewTaskDefinition(ctx, fmt.Sprintf("%s-task-def", name), &ecs.TaskDefinitionArgs{
@@ -89,7 +112,7 @@ func NewContainerService(ctx *pulumi.Context, name string, args *ContainerServic
 		Cpu:                     pulumi.String(fmt.Sprintf("%d", args.TaskDefinitionArgs.Cpu)),
 		Memory:                  pulumi.String(fmt.Sprintf("%d", args.TaskDefinitionArgs.Memory)),
 		ExecutionRoleArn:        executionRole.Arn,
-		TaskRoleArn:             taskRole.Arn,
+		TaskRoleArn:             resource.TaskRoleArn,
 		ContainerDefinitions:    args.TaskDefinitionArgs.ContainerDefinitions,
 	}, options...)
 
@@ -117,10 +140,13 @@ func NewContainerService(ctx *pulumi.Context, name string, args *ContainerServic
 		NetworkConfiguration: ecs.ServiceNetworkConfigurationArgs{
 			AssignPublicIp: pulumi.Bool(false),
 			Subnets:        args.PrivateSubnetIds,
-			SecurityGroups: pulumi.StringArray{resource.SecurityGroup.ID()},
+			SecurityGroups: append(pulumi.StringArray{resource.SecurityGroup.ID()}, args.SecurityGroupIds...),
 		},
 		TaskDefinition:     taskDefinition.Arn,
 		WaitForSteadyState: pulumi.Bool(false),
+		// tasks carry the service's tags so Fargate usage shows up in cost allocation reports
+		EnableEcsManagedTags: pulumi.Bool(true),
+		PropagateTags:        pulumi.String("SERVICE"),
 	}, options...)
 
 	if err != nil {
@@ -210,20 +236,6 @@ func NewEscServiceSecurityGroup(ctx *pulumi.Context, name string, args *Containe
 		// routeable public internet access is denied
 		// note, this could be routed to TGW/proxy if needed at some point in future
 		sgEgress = ec2.SecurityGroupEgressArray{
-			ec2.SecurityGroupEgressArgs{
-				FromPort:    pulumi.Int(443),
-				ToPort:      pulumi.Int(443),
-				Protocol:    pulumi.String("TCP"),
-				CidrBlocks:  pulumi.StringArray{args.VpcCidrBlock},
-				Description: pulumi.String("Allow egress on 443 to entire VPC CIDR private netowrk"),
-			},
-			ec2.SecurityGroupEgressArgs{
-				FromPort:    pulumi.Int(80),
-				ToPort:      pulumi.Int(80),
-				Protocol:    pulumi.String("TCP"),
-				CidrBlocks:  pulumi.StringArray{args.VpcCidrBlock},
-				Description: pulumi.String("Allow egress on 80 to entire VPC CIDR private netowrk"),
-			},
 			ec2.SecurityGroupEgressArgs{
 				FromPort:       pulumi.Int(443),
 				ToPort:         pulumi.Int(443),
@@ -239,6 +251,26 @@ func NewEscServiceSecurityGroup(ctx *pulumi.Context, name string, args *Containe
 				Description:   pulumi.String("Allow egress from ecs service to S3 VPC Endpoint"),
 			},
 		}
+
+		// in natless mode services add the in-VPC destinations they need (DB, internal LB, OpenSearch) through SecurityGroupEgressRules
+		if !args.EnableNatlessMode {
+			sgEgress = append(ec2.SecurityGroupEgressArray{
+				ec2.SecurityGroupEgressArgs{
+					FromPort:    pulumi.Int(443),
+					ToPort:      pulumi.Int(443),
+					Protocol:    pulumi.String("TCP"),
+					CidrBlocks:  pulumi.StringArray{args.VpcCidrBlock},
+					Description: pulumi.String("Allow egress on 443 to entire VPC CIDR private netowrk"),
+				},
+				ec2.SecurityGroupEgressArgs{
+					FromPort:    pulumi.Int(80),
+					ToPort:      pulumi.Int(80),
+					Protocol:    pulumi.String("TCP"),
+					CidrBlocks:  pulumi.StringArray{args.VpcCidrBlock},
+					Description: pulumi.String("Allow egress on 80 to entire VPC CIDR private netowrk"),
+				},
+			}, sgEgress...)
+		}
 	}
 
 	// add sg rules from args
@@ -262,6 +294,16 @@ func NewEscServiceSecurityGroup(ctx *pulumi.Context, name string, args *Containe
 	return sg, nil
 }
 
+// the service's container followed by any containers its log driver runs alongside it
+func withLogSidecars(container map[string]any, logDriver log.LogDriver) []any {
+	containers := []any{container}
+	for _, sidecar := range logDriver.GetSidecars() {
+		containers = append(containers, sidecar)
+	}
+
+	return containers
+}
+
 // create an IAM role that ECS tasks are capable of assuming. rolePolicyDocs allows caller to inject additional policies as needed
 func NewEcsRole(ctx *pulumi.Context, name string, region string, rolePolicyDocs pulumi.StringArray, options ...pulumi.ResourceOption) (*iam.Role, error) {
 	roleName := fmt.Sprintf("%s-role", name)
@@ -283,16 +325,26 @@ func NewEcsRole(ctx *pulumi.Context, name string, region string, rolePolicyDocs
 		return nil, err
 	}
 
+	err = attachEcsRolePolicies(ctx, name, region, role, rolePolicyDocs, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// attach the ECS task execution policy and rolePolicyDocs to a role ECS tasks can assume
+func attachEcsRolePolicies(ctx *pulumi.Context, name string, region string, role pulumi.Input, rolePolicyDocs pulumi.StringArray, options ...pulumi.ResourceOption) error {
 	policyArn := common.GetIamPolicyArn(region, string(iam.ManagedPolicyAmazonECSTaskExecutionRolePolicy))
 
 	rpaAttachName := fmt.Sprintf("%s-role-attachment", name)
-	_, err = iam.NewRolePolicyAttachment(ctx, rpaAttachName, &iam.RolePolicyAttachmentArgs{
+	_, err := iam.NewRolePolicyAttachment(ctx, rpaAttachName, &iam.RolePolicyAttachmentArgs{
 		Role:      role,
 		PolicyArn: pulumi.String(policyArn),
 	}, options...)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(rolePolicyDocs) > 0 {
@@ -304,12 +356,12 @@ func NewEcsRole(ctx *pulumi.Context, name string, region string, rolePolicyDocs
 			}, options...)
 
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
 
-	return role, nil
+	return nil
 }
 
 // create a new scaling policy capable of scaling up and down via our target metric. Eg- cpu/memory/etc
@@ -361,11 +413,54 @@ func NewSecretsManagerPolicy(ctx *pulumi.Context, name string, region string, se
 	}).(pulumi.StringOutput), nil
 }
 
+// IAM policy should allow ECS tasks to pull the database credentials secret, which lives outside of our secrets prefix
+func NewDatabaseSecretPolicy(secretArn pulumi.StringOutput, kmsKeyArn pulumi.StringOutput, secretKmsKeyArn pulumi.StringOutput) pulumi.StringOutput {
+	return pulumi.All(secretArn, kmsKeyArn, secretKmsKeyArn).ApplyT(func(applyArgs []any) (string, error) {
+		statements := []map[string]any{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"secretsmanager:GetSecretValue"},
+				"Resource": []string{applyArgs[0].(string)},
+			},
+		}
+
+		// the managed secret is encrypted with the data key when one is provided, otherwise aws/secretsmanager;
+		// an existing database's secret may have its own customer managed key
+		var keyArns []string
+		for _, arg := range applyArgs[1:] {
+			if arn := arg.(string); arn != "" && !slices.Contains(keyArns, arn) {
+				keyArns = append(keyArns, arn)
+			}
+		}
+
+		if len(keyArns) > 0 {
+			statements = append(statements, map[string]any{
+				"Effect":   "Allow",
+				"Action":   []string{"kms:Decrypt"},
+				"Resource": keyArns,
+			})
+		}
+
+		doc, err := json.Marshal(map[string]any{
+			"Version":   "2012-10-17",
+			"Statement": statements,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(doc), nil
+	}).(pulumi.StringOutput)
+}
+
 type ContainerBaseArgs struct {
 	AccountId                               string
 	CertificateArn                          string
 	Cluster                                 *ecs.Cluster
+	DataKmsKeyArn                           pulumi.StringOutput
 	EnablePrivateLoadBalancerAndLimitEgress bool
+	EnableNatlessMode                       bool
 	KmsServiceKeyId                         string
 	PrefixListId                            pulumi.StringOutput
 	PrivateSubnetIds                        pulumi.StringArrayOutput
@@ -385,9 +480,12 @@ type ContainerServiceArgs struct {
 	PulumiInternalLoadBalancer *network.PulumiInternalLoadBalancer
 	SecurityGroupEgressRules   ec2.SecurityGroupEgressArray
 	SecurityGroupIngressRules  ec2.SecurityGroupIngressArray
+	SecurityGroupIds           pulumi.StringArray
 	TargetGroups               []*lb.TargetGroup
 	TargetPort                 int
 	TaskDefinitionArgs         *TaskDefinitionArgs
+	TaskRoleName               string
+	TaskRoleArn                string
 }
 
 type ContainerService struct {
@@ -396,6 +494,7 @@ type ContainerService struct {
 	Cluster       *ecs.Cluster
 	SecurityGroup *ec2.SecurityGroup
 	Service       *ecs.Service
+	TaskRoleArn   pulumi.StringOutput
 }
 
 type TaskDefinitionArgs struct {
@@ -407,12 +506,20 @@ type TaskDefinitionArgs struct {
 	ContainerPort           int
 	ExecutionRolePolicyDocs pulumi.StringArray
 	TaskRolePolicyDocs      pulumi.StringArray
+	LogDriver               log.LogDriver
 }
 
 type SecretsArgs struct {
-	Secrets  []Secret
-	Prefix   string
-	KmsKeyId string
+	Secrets    []Secret
+	References []SecretReference
+	Prefix     string
+	KmsKeyId   string
+}
+
+type SecretReference struct {
+	Name      string
+	SecretArn pulumi.StringOutput
+	JsonKey   string
 }
 
 type Secret struct {
@@ -73,6 +73,9 @@ func newMigrationTask(ctx *pulumi.Context, client *ecs.Client, clusterId string,
 		Group:          &taskName,
 		TaskDefinition: &taskDefArn,
 		LaunchType:     "FARGATE",
+		// the task definition is tagged through the provider's default tags
+		EnableECSManagedTags: true,
+		PropagateTags:        types.PropagateTagsTaskDefinition,
 		NetworkConfiguration: &types.NetworkConfiguration{
 			AwsvpcConfiguration: &types.AwsVpcConfiguration{
 				AssignPublicIp: "DISABLED",
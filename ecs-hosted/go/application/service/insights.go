@@ -1,71 +1,241 @@
 package service
 
 import (
-	// "fmt"
+	"encoding/json"
+	"fmt"
 
-	// "github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
-	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/config"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/lb"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/log"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/application/network"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
-func DeployOpenSearchDashboards(ctx *pulumi.Context, config *config.ConfigArgs, OpenSearchDomainEndpoint pulumi.StringOutput, vpcId pulumi.StringOutput, subnetIds pulumi.StringArrayOutput, securityGroupId pulumi.StringOutput) error {
-	// Create ECS cluster
-	// cluster, err := ecs.NewCluster(ctx, "OpenSearchDashboardsCluster", nil)
-	// if err != nil {
-	// 	return err
-	// }
-
-	// // Create ECS task definition
-	// taskDefinition, err := ecs.NewTaskDefinition(ctx, "OpenSearchDashboardsTask", &ecs.TaskDefinitionArgs{
-	// 	ContainerDefinitions: OpenSearchDomainEndpoint.ApplyT(func(endpoint string) string {
-	// 		return fmt.Sprintf(`[
-	// 			{
-	// 				"name": "OpenSearch-dashboards",
-	// 				"image": "OpenSearchproject/OpenSearch-dashboards:latest",
-	// 				"memory": %d,
-	// 				"cpu": %d,
-	// 				"essential": true,
-	// 				"portMappings": [
-	// 					{
-	// 						"containerPort": 5601,
-	// 						"hostPort": 5601
-	// 					}
-	// 				],
-	// 				"environment": [
-	// 					{
-	// 						"name": "OpenSearch_HOSTS",
-	// 						"value": "%s"
-	// 					}
-	// 				]
-	// 			}
-	// 		]`, config.OpenSearchDashboardsMemory, config.OpenSearchDashboardsCpu, endpoint)
-	// 	}).(pulumi.StringOutput),
-	// 	Family:      pulumi.String("OpenSearch-dashboards"),
-	// 	NetworkMode: pulumi.String("awsvpc"),
-	// 	RequiresCompatibilities: pulumi.StringArray{
-	// 		pulumi.String("FARGATE"),
-	// 	},
-	// 	Cpu:              pulumi.String("256"),
-	// 	Memory:           pulumi.String("512"),
-	// 	ExecutionRoleArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"),
-	// })
-	// if err != nil {
-	// 	return err
-	// }
-
-	// // Create ECS service
-	// _, err = ecs.NewService(ctx, "OpenSearchDashboardsService", &ecs.ServiceArgs{
-	// 	Cluster:        cluster.Arn,
-	// 	TaskDefinition: taskDefinition.Arn,
-	// 	DesiredCount:   pulumi.Int(1),
-	// 	NetworkConfiguration: &ecs.ServiceNetworkConfigurationArgs{
-	// 		Subnets:        subnetIds,
-	// 		SecurityGroups: pulumi.StringArray{securityGroupId},
-	// 	},
-	// })
-	// if err != nil {
-	// 	return err
-	// }
-
-	return nil
+const dashboardsPort = 5601
+const dashboardsContainerName = "opensearch-dashboards"
+
+/*
+OpenSearch Dashboards for browsing the search domain used by Pulumi Resource Search
+Served from its own hostname on the public load balancer, so it is subject to the same IP allow-list as the API and console
+Dashboards signs in to OpenSearch with the domain's admin user; users log in with the same credentials
+*/
+func DeployOpenSearchDashboards(ctx *pulumi.Context, name string, args *OpenSearchDashboardsServiceArgs, opts ...pulumi.ResourceOption) (*OpenSearchDashboardsService, error) {
+	var resource OpenSearchDashboardsService
+
+	err := ctx.RegisterComponentResource("pulumi:openSearchDashboardsService", name, &resource, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// create our parented options
+	options := append(opts, pulumi.Parent(&resource))
+
+	listenerConditions := &lb.ListenerRuleConditionArray{
+		lb.ListenerRuleConditionArgs{
+			HostHeader: lb.ListenerRuleConditionHostHeaderArgs{
+				Values: pulumi.StringArray{pulumi.String(args.DashboardsUrl)},
+			},
+		},
+	}
+
+	secrets, err := NewSecrets(ctx, fmt.Sprintf("%s-secrets", name), &SecretsArgs{
+		Prefix:   args.SecretsManagerPrefix,
+		KmsKeyId: args.KmsServiceKeyId,
+		Secrets: []Secret{
+			{
+				Name:  "OPENSEARCH_PASSWORD",
+				Value: args.OpenSearchPassword,
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	taskArgs := newDashboardsTaskArgs(args, secrets)
+
+	tgName := fmt.Sprintf("%s-tg", name)
+	tgOptions := append(options, pulumi.DeleteBeforeReplace(true))
+	tg, err := lb.NewTargetGroup(ctx, tgName, &lb.TargetGroupArgs{
+		VpcId:      args.VpcId,
+		Protocol:   pulumi.String("HTTP"),
+		Port:       pulumi.Int(dashboardsPort),
+		TargetType: pulumi.String("ip"),
+		HealthCheck: &lb.TargetGroupHealthCheckArgs{
+			Interval: pulumi.Int(10), //seconds
+			// unauthenticated requests are redirected to the login page
+			Path:               pulumi.String("/"),
+			Port:               pulumi.String(fmt.Sprintf("%d", dashboardsPort)),
+			Protocol:           pulumi.String("HTTP"),
+			Matcher:            pulumi.String("200-399"),
+			Timeout:            pulumi.Int(5), //seconds
+			HealthyThreshold:   pulumi.Int(5),
+			UnhealthyThreshold: pulumi.Int(2),
+		},
+	}, tgOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	httpsListener, err := args.TrafficManager.Public.CreateListenerRule(ctx, fmt.Sprintf("%s-https", name), true, tg.Arn, listenerConditions, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	httpListener, err := args.TrafficManager.Public.CreateListenerRule(ctx, fmt.Sprintf("%s-http", name), false, tg.Arn, listenerConditions, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the managed domain only admits the API security group, so Dashboards join it
+	var searchSecurityGroupIds pulumi.StringArray
+	if args.SecurityGroupId != "" {
+		searchSecurityGroupIds = pulumi.StringArray{pulumi.String(args.SecurityGroupId)}
+	}
+
+	serviceOptions := append(options, pulumi.DependsOn([]pulumi.Resource{httpsListener, httpListener}))
+	resource.ContainerService, err = NewContainerService(ctx, name, &ContainerServiceArgs{
+		ContainerBaseArgs:          args.ContainerBaseArgs,
+		PulumiLoadBalancer:         args.TrafficManager.Public,
+		PulumiInternalLoadBalancer: args.TrafficManager.Internal,
+		TargetPort:                 dashboardsPort,
+		TaskDefinitionArgs:         taskArgs,
+		TargetGroups:               []*lb.TargetGroup{tg},
+		SecurityGroupEgressRules:   newOpenSearchEgressRules(&args.ContainerBaseArgs),
+		SecurityGroupIds:           searchSecurityGroupIds,
+	}, serviceOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sgOptions := append(options, pulumi.DeleteBeforeReplace(true))
+	_, err = ec2.NewSecurityGroupRule(ctx, fmt.Sprintf("%s-lb-to-ecs-rule", name), &ec2.SecurityGroupRuleArgs{
+		Type:                  pulumi.String("egress"),
+		SecurityGroupId:       args.TrafficManager.Public.SecurityGroup.ID(),
+		SourceSecurityGroupId: resource.ContainerService.SecurityGroup.ID(),
+		FromPort:              pulumi.Int(dashboardsPort),
+		ToPort:                pulumi.Int(dashboardsPort),
+		Protocol:              pulumi.String("TCP"),
+		Description:           pulumi.String("Allow access from LB to OpenSearch Dashboards ecs service"),
+	}, sgOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &resource, nil
+}
+
+func newDashboardsTaskArgs(args *OpenSearchDashboardsServiceArgs, secrets *SecretsOutput) *TaskDefinitionArgs {
+	// set out defaults for the dashboards container task
+	taskMemory := 1024
+	if args.TaskMemory > 0 {
+		taskMemory = args.TaskMemory
+	}
+
+	taskCpu := 512
+	if args.TaskCpu > 0 {
+		taskCpu = args.TaskCpu
+	}
+
+	// resolve all needed outputs to construct our container definition in JSON
+	containerDefinitions := pulumi.All(
+		args.OpenSearchEndpoint,
+		args.OpenSearchUser,
+		secrets.Secrets,
+		args.LogDriver).ApplyT(func(applyArgs []any) (string, error) {
+
+		endpoint := applyArgs[0].(string)
+		user := applyArgs[1].(string)
+		secretsOutput := applyArgs[2].([]map[string]any)
+		logDriver := applyArgs[3].(log.LogDriver)
+
+		containerJson, err := json.Marshal(withLogSidecars(map[string]any{
+			"cpu": taskCpu,
+			"environment": []map[string]any{
+				CreateEnvVar("OPENSEARCH_HOSTS", endpoint),
+				CreateEnvVar("OPENSEARCH_USERNAME", user),
+				// browsers only reach dashboards through the HTTPS listener
+				CreateEnvVar("OPENSEARCH_SECURITY_COOKIE_SECURE", "true"),
+			},
+			"image":            args.Image,
+			"logConfiguration": logDriver.GetConfiguration(),
+			"memory":           taskMemory,
+			"name":             dashboardsContainerName,
+			"portMappings": []map[string]any{
+				{
+					"containerPort": dashboardsPort,
+				},
+			},
+			"secrets": secretsOutput,
+		}, logDriver))
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(containerJson), nil
+	}).(pulumi.StringOutput)
+
+	return &TaskDefinitionArgs{
+		ContainerDefinitions: containerDefinitions,
+		LogDriver:            args.LogDriver,
+		NumberDesiredTasks:   1,
+		Cpu:                  taskCpu,
+		Memory:               taskMemory,
+		ContainerName:        dashboardsContainerName,
+		ContainerPort:        dashboardsPort,
+	}
+}
+
+// OpenSearch sits in the private subnets and is reached directly, not through an endpoint
+// the managed domain listens on 443, already open to the VPC unless in natless mode; the self-managed container listens on 9200
+func newOpenSearchEgressRules(args *ContainerBaseArgs) ec2.SecurityGroupEgressArray {
+	var rules ec2.SecurityGroupEgressArray
+
+	if args.EnableNatlessMode {
+		rules = append(rules, ec2.SecurityGroupEgressArgs{
+			FromPort:    pulumi.Int(443),
+			ToPort:      pulumi.Int(443),
+			Protocol:    pulumi.String("TCP"),
+			CidrBlocks:  pulumi.StringArray{args.VpcCidrBlock},
+			Description: pulumi.String("Allow egress from ECS service to OpenSearch"),
+		})
+	}
+
+	if args.EnablePrivateLoadBalancerAndLimitEgress {
+		rules = append(rules, ec2.SecurityGroupEgressArgs{
+			FromPort:    pulumi.Int(9200),
+			ToPort:      pulumi.Int(9200),
+			Protocol:    pulumi.String("TCP"),
+			CidrBlocks:  pulumi.StringArray{args.VpcCidrBlock},
+			Description: pulumi.String("Allow egress from ECS service to the OpenSearch container"),
+		})
+	}
+
+	return rules
+}
+
+type OpenSearchDashboardsServiceArgs struct {
+	ContainerBaseArgs
+
+	DashboardsUrl      string
+	Image              string
+	LogDriver          log.LogDriver
+	OpenSearchEndpoint pulumi.StringOutput
+	OpenSearchUser     pulumi.StringOutput
+	OpenSearchPassword pulumi.StringOutput
+	SecurityGroupId    string
+	TaskMemory         int
+	TaskCpu            int
+	TrafficManager     *network.TrafficManager
+}
+
+type OpenSearchDashboardsService struct {
+	pulumi.ResourceState
+
+	ContainerService *ContainerService
 }
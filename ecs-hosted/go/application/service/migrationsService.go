@@ -59,6 +59,15 @@ func NewMigrationsService(ctx *pulumi.Context, name string, args *MigrationsCont
 		return nil, err
 	}
 
+	_, err = iam.NewRolePolicy(ctx, fmt.Sprintf("%s-db-secret-pol", name), &iam.RolePolicyArgs{
+		Role:   role,
+		Policy: NewDatabaseSecretPolicy(args.DatabaseArgs.CredentialsSecretArn, args.DataKmsKeyArn, args.DatabaseArgs.CredentialsKmsKeyArn),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
 	egress := args.SecurityGroupEgressRules
 
 	if args.EnablePrivateLoadBalancerAndLimitEgress {
@@ -107,7 +116,18 @@ func NewMigrationsService(ctx *pulumi.Context, name string, args *MigrationsCont
 	imageName := fmt.Sprintf("pulumi/migrations:%s", args.ImageTag)
 	fullQualifiedImage := utils.NewEcrImageTag(ecrAccountId, args.Region, imageName, args.ImagePrefix)
 
-	containerDef, err := newContainerDefinitions(ctx, "migrations-task", args, fullQualifiedImage, options...)
+	// exposed so the migration logs can be archived with the service logs
+	resource.LogGroup, err = cloudwatch.NewLogGroup(ctx, "migrations-task-log-group", &cloudwatch.LogGroupArgs{
+		NamePrefix:      pulumi.String("migrations-task-pulumi-migration-logs"),
+		RetentionInDays: pulumi.Int(1),
+		KmsKeyId:        utils.OptionalString(args.DataKmsKeyArn),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	containerDef, err := newContainerDefinitions(ctx, "migrations-task", args, fullQualifiedImage, resource.LogGroup, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -186,27 +206,20 @@ func NewMigrationsService(ctx *pulumi.Context, name string, args *MigrationsCont
 	return &resource, nil
 }
 
-func newContainerDefinitions(ctx *pulumi.Context, name string, args *MigrationsContainerServiceArgs, image string, options ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
-	logGroup, err := cloudwatch.NewLogGroup(ctx, fmt.Sprintf("%s-log-group", name), &cloudwatch.LogGroupArgs{
-		NamePrefix:      pulumi.String(fmt.Sprintf("%s-pulumi-migration-logs", name)),
-		RetentionInDays: pulumi.Int(1),
-	}, options...)
-
-	if err != nil {
-		return pulumi.StringOutput{}, err
-	}
-
+func newContainerDefinitions(ctx *pulumi.Context, name string, args *MigrationsContainerServiceArgs, image string, logGroup *cloudwatch.LogGroup, options ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
 	secrets, err := NewSecrets(ctx, fmt.Sprintf("%s-secrets", name), &SecretsArgs{
 		Prefix:   args.SecretsManagerPrefix,
 		KmsKeyId: args.KmsServiceKeyId,
-		Secrets: []Secret{
+		References: []SecretReference{
 			{
-				Name:  "MYSQL_ROOT_USERNAME",
-				Value: args.DatabaseArgs.Username,
+				Name:      "MYSQL_ROOT_USERNAME",
+				SecretArn: args.DatabaseArgs.CredentialsSecretArn,
+				JsonKey:   "username",
 			},
 			{
-				Name:  "MYSQL_ROOT_PASSWORD",
-				Value: args.DatabaseArgs.Password,
+				Name:      "MYSQL_ROOT_PASSWORD",
+				SecretArn: args.DatabaseArgs.CredentialsSecretArn,
+				JsonKey:   "password",
 			},
 		},
 	}, options...)
@@ -219,12 +232,14 @@ func newContainerDefinitions(ctx *pulumi.Context, name string, args *MigrationsC
 		args.DatabaseArgs.ClusterEndpoint,
 		args.DatabaseArgs.Port,
 		secrets.Secrets,
-		logGroup.ID()).ApplyT(func(applyArgs []any) (string, error) {
+		logGroup.ID(),
+		args.DatabaseArgs.Name).ApplyT(func(applyArgs []any) (string, error) {
 
 		dbClusterEndpoint := applyArgs[0].(string)
 		dbPort := applyArgs[1].(int)
 		secretsOutput := applyArgs[2].([]map[string]any)
 		logId := applyArgs[3].(pulumi.ID)
+		dbName := applyArgs[4].(string)
 
 		containerJson, err := json.Marshal([]any{
 			map[string]any{
@@ -236,6 +251,7 @@ func newContainerDefinitions(ctx *pulumi.Context, name string, args *MigrationsC
 					CreateEnvVar("SKIP_CREATE_DB_USER", "true"),
 					CreateEnvVar("PULUMI_DATABASE_ENDPOINT", fmt.Sprintf("%s:%d", dbClusterEndpoint, dbPort)),
 					CreateEnvVar("PULUMI_DATABASE_PING_ENDPOINT", dbClusterEndpoint),
+					CreateEnvVar("PULUMI_DATABASE_NAME", dbName),
 				},
 				"secrets": secretsOutput,
 				"logConfiguration": map[string]any{
@@ -274,4 +290,5 @@ type MigrationsContainerService struct {
 	pulumi.ResourceState
 
 	SecurityGroup *ec2.SecurityGroup
+	LogGroup      *cloudwatch.LogGroup
 }
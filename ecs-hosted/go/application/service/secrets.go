@@ -10,6 +10,7 @@ import (
 
 /*
 Allow a caller to create secrets in AWS SecretsManager
+Secrets owned elsewhere, eg- the Aurora managed credentials, are referenced by ARN and JSON key instead of being copied
 */
 func NewSecrets(ctx *pulumi.Context, name string, args *SecretsArgs, opts ...pulumi.ResourceOption) (*SecretsOutput, error) {
 	var resource SecretsOutput
@@ -51,6 +52,13 @@ func NewSecrets(ctx *pulumi.Context, name string, args *SecretsArgs, opts ...pul
 		})
 	}
 
+	for _, r := range args.References {
+		outputs = append(outputs, map[string]any{
+			"name":      r.Name,
+			"valueFrom": pulumi.Sprintf("%s:%s::", r.SecretArn, r.JsonKey),
+		})
+	}
+
 	resource.Secrets = outputs
 
 	return &resource, nil
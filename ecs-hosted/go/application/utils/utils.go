@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
 func NewEcrImageTag(accountId string, region string, imageName string, imagePrefix string) string {
@@ -11,3 +13,13 @@ func NewEcrImageTag(accountId string, region string, imageName string, imagePref
 		return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s%s", accountId, region, imagePrefix, imageName)
 	}
 }
+
+// convert an empty string output into a nil pointer so optional resource arguments are left unset
+func OptionalString(value pulumi.StringOutput) pulumi.StringPtrOutput {
+	return value.ApplyT(func(v string) *string {
+		if v == "" {
+			return nil
+		}
+		return &v
+	}).(pulumi.StringPtrOutput)
+}
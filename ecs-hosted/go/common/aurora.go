@@ -0,0 +1,60 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompareAuroraMysqlVersions compares two Aurora MySQL engine versions, eg- 8.0.mysql_aurora.3.12.0
+// It returns -1 if a is older than b, 0 if they are the same and 1 if a is newer than b.
+func CompareAuroraMysqlVersions(a string, b string) (int, error) {
+	aParts, err := parseAuroraMysqlVersion(a)
+	if err != nil {
+		return 0, err
+	}
+
+	bParts, err := parseAuroraMysqlVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if aParts[i] < bParts[i] {
+			return -1, nil
+		}
+
+		if aParts[i] > bParts[i] {
+			return 1, nil
+		}
+	}
+
+	switch {
+	case len(aParts) < len(bParts):
+		return -1, nil
+	case len(aParts) > len(bParts):
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// flatten the MySQL compatibility and Aurora versions into a single list of numbers, eg- [8 0 3 12 0]
+func parseAuroraMysqlVersion(version string) ([]int, error) {
+	mysqlVersion, auroraVersion, found := strings.Cut(version, ".mysql_aurora.")
+	if !found {
+		return nil, fmt.Errorf("%s is not an Aurora MySQL engine version", version)
+	}
+
+	var parts []int
+	for _, p := range append(strings.Split(mysqlVersion, "."), strings.Split(auroraVersion, ".")...) {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an Aurora MySQL engine version", version)
+		}
+
+		parts = append(parts, n)
+	}
+
+	return parts, nil
+}
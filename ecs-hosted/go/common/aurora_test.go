@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestCompareAuroraMysqlVersions(t *testing.T) {
+	cases := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"8.0.mysql_aurora.3.12.0", "8.0.mysql_aurora.3.12.0", 0},
+		{"8.0.mysql_aurora.3.04.1", "8.0.mysql_aurora.3.12.0", -1},
+		{"8.0.mysql_aurora.3.12.1", "8.0.mysql_aurora.3.12.0", 1},
+		{"5.7.mysql_aurora.2.11.2", "8.0.mysql_aurora.3.12.0", -1},
+	}
+
+	for _, c := range cases {
+		res, err := CompareAuroraMysqlVersions(c.a, c.b)
+		if err != nil || res != c.expected {
+			t.Fatalf("comparing %s to %s: expected %d, got %d (%v)", c.a, c.b, c.expected, res, err)
+		}
+	}
+}
+
+func TestCompareAuroraMysqlVersionsInvalid(t *testing.T) {
+	if _, err := CompareAuroraMysqlVersions("8.0.32", "8.0.mysql_aurora.3.12.0"); err == nil {
+		t.Fatalf("community MySQL version should fail")
+	}
+
+	if _, err := CompareAuroraMysqlVersions("8.0.mysql_aurora.3.x.0", "8.0.mysql_aurora.3.12.0"); err == nil {
+		t.Fatalf("non numeric version should fail")
+	}
+}
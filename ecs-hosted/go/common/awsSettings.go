@@ -0,0 +1,273 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	awsprovider "github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// AwsAssumeRole is one entry of aws:assumeRoles; roles are assumed in order, each with the credentials of the one before
+type AwsAssumeRole struct {
+	RoleArn           string            `json:"roleArn"`
+	SessionName       string            `json:"sessionName"`
+	ExternalId        string            `json:"externalId"`
+	Duration          string            `json:"duration"`
+	Policy            string            `json:"policy"`
+	PolicyArns        []string          `json:"policyArns"`
+	SourceIdentity    string            `json:"sourceIdentity"`
+	Tags              map[string]string `json:"tags"`
+	TransitiveTagKeys []string          `json:"transitiveTagKeys"`
+}
+
+// AwsSettings are the aws: settings of the stack that decide how, and as whom, the default provider reaches AWS.
+// Providers for other regions and AWS SDK clients are built from them so they run with the same credentials as the stack.
+type AwsSettings struct {
+	Region                    string
+	Profile                   string
+	AccessKey                 string
+	SecretKey                 string
+	Token                     string
+	StsRegion                 string
+	CustomCaBundle            string
+	HttpProxy                 string
+	HttpsProxy                string
+	NoProxy                   string
+	SkipCredentialsValidation bool
+	SkipRequestingAccountId   bool
+	SharedConfigFiles         []string
+	SharedCredentialsFiles    []string
+	AllowedAccountIds         []string
+	ForbiddenAccountIds       []string
+	AssumeRoles               []AwsAssumeRole
+}
+
+// ReadAwsSettings reads the aws: settings from the stack configuration
+func ReadAwsSettings(ctx *pulumi.Context) (*AwsSettings, error) {
+	awsConfig := config.New(ctx, "aws")
+	settings := &AwsSettings{
+		Region:                    awsConfig.Require("region"),
+		Profile:                   awsConfig.Get("profile"),
+		AccessKey:                 awsConfig.Get("accessKey"),
+		SecretKey:                 awsConfig.Get("secretKey"),
+		Token:                     awsConfig.Get("token"),
+		StsRegion:                 awsConfig.Get("stsRegion"),
+		CustomCaBundle:            awsConfig.Get("customCaBundle"),
+		HttpProxy:                 awsConfig.Get("httpProxy"),
+		HttpsProxy:                awsConfig.Get("httpsProxy"),
+		NoProxy:                   awsConfig.Get("noProxy"),
+		SkipCredentialsValidation: awsConfig.GetBool("skipCredentialsValidation"),
+		SkipRequestingAccountId:   awsConfig.GetBool("skipRequestingAccountId"),
+	}
+
+	for key, target := range map[string]*[]string{
+		"sharedConfigFiles":      &settings.SharedConfigFiles,
+		"sharedCredentialsFiles": &settings.SharedCredentialsFiles,
+		"allowedAccountIds":      &settings.AllowedAccountIds,
+		"forbiddenAccountIds":    &settings.ForbiddenAccountIds,
+	} {
+		err := awsConfig.GetObject(key, target)
+		if err != nil {
+			return nil, fmt.Errorf("aws:%s must be a list of strings: %w", key, err)
+		}
+	}
+
+	err := awsConfig.GetObject("assumeRoles", &settings.AssumeRoles)
+	if err != nil {
+		return nil, fmt.Errorf("aws:assumeRoles must be a list of assume role settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+/*
+NewAwsSdkConfig returns an AWS SDK configuration for the given region that authenticates like the stack's default provider.
+Static keys, the profile and shared files select the base credentials, then each of aws:assumeRoles is assumed in turn.
+*/
+func NewAwsSdkConfig(ctx context.Context, settings *AwsSettings, region string) (aws.Config, error) {
+	options := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(region),
+	}
+
+	if settings.Profile != "" {
+		options = append(options, awsconfig.WithSharedConfigProfile(settings.Profile))
+	}
+
+	if len(settings.SharedConfigFiles) > 0 {
+		options = append(options, awsconfig.WithSharedConfigFiles(settings.SharedConfigFiles))
+	}
+
+	if len(settings.SharedCredentialsFiles) > 0 {
+		options = append(options, awsconfig.WithSharedCredentialsFiles(settings.SharedCredentialsFiles))
+	}
+
+	if settings.AccessKey != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(settings.AccessKey, settings.SecretKey, settings.Token)))
+	}
+
+	if settings.CustomCaBundle != "" {
+		bundle, err := os.ReadFile(settings.CustomCaBundle)
+		if err != nil {
+			return aws.Config{}, fmt.Errorf("unable to read aws:customCaBundle: %w", err)
+		}
+
+		options = append(options, awsconfig.WithCustomCABundle(bytes.NewReader(bundle)))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	for _, role := range settings.AssumeRoles {
+		if role.RoleArn == "" {
+			continue
+		}
+
+		var duration time.Duration
+		if role.Duration != "" {
+			duration, err = time.ParseDuration(role.Duration)
+			if err != nil {
+				return aws.Config{}, fmt.Errorf("aws:assumeRoles duration %s of %s is not a duration, eg- 1h: %w", role.Duration, role.RoleArn, err)
+			}
+		}
+
+		client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+			if settings.StsRegion != "" {
+				o.Region = settings.StsRegion
+			}
+		})
+
+		provider := stscreds.NewAssumeRoleProvider(client, role.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = role.SessionName
+			o.Duration = duration
+			o.TransitiveTagKeys = role.TransitiveTagKeys
+
+			if role.ExternalId != "" {
+				o.ExternalID = aws.String(role.ExternalId)
+			}
+
+			if role.Policy != "" {
+				o.Policy = aws.String(role.Policy)
+			}
+
+			if role.SourceIdentity != "" {
+				o.SourceIdentity = aws.String(role.SourceIdentity)
+			}
+
+			for _, arn := range role.PolicyArns {
+				o.PolicyARNs = append(o.PolicyARNs, ststypes.PolicyDescriptorType{Arn: aws.String(arn)})
+			}
+
+			for k, v := range role.Tags {
+				o.Tags = append(o.Tags, ststypes.Tag{Key: aws.String(k), Value: aws.String(v)})
+			}
+		})
+
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return cfg, nil
+}
+
+/*
+NewRegionalProviderArgs returns the arguments of a provider in another region, eg- the DR region, that authenticates like the stack's default provider.
+The aws: settings that select credentials, assume roles, restrict accounts or reach AWS through a proxy are copied; only the region differs.
+*/
+func NewRegionalProviderArgs(settings *common.AwsSettings, region string) *awsprovider.ProviderArgs {
+	args := &awsprovider.ProviderArgs{
+		Region:         pulumi.String(region),
+		Profile:        optionalString(settings.Profile),
+		StsRegion:      optionalString(settings.StsRegion),
+		CustomCaBundle: optionalString(settings.CustomCaBundle),
+		HttpProxy:      optionalString(settings.HttpProxy),
+		HttpsProxy:     optionalString(settings.HttpsProxy),
+		NoProxy:        optionalString(settings.NoProxy),
+	}
+
+	// static credentials are secrets in the stack config and stay secret in the provider's state
+	if settings.AccessKey != "" {
+		args.AccessKey = pulumi.ToSecret(pulumi.String(settings.AccessKey)).(pulumi.StringOutput)
+		args.SecretKey = pulumi.ToSecret(pulumi.String(settings.SecretKey)).(pulumi.StringOutput)
+	}
+
+	if settings.Token != "" {
+		args.Token = pulumi.ToSecret(pulumi.String(settings.Token)).(pulumi.StringOutput)
+	}
+
+	if settings.SkipCredentialsValidation {
+		args.SkipCredentialsValidation = pulumi.Bool(true)
+	}
+
+	if settings.SkipRequestingAccountId {
+		args.SkipRequestingAccountId = pulumi.Bool(true)
+	}
+
+	if len(settings.SharedConfigFiles) > 0 {
+		args.SharedConfigFiles = pulumi.ToStringArray(settings.SharedConfigFiles)
+	}
+
+	if len(settings.SharedCredentialsFiles) > 0 {
+		args.SharedCredentialsFiles = pulumi.ToStringArray(settings.SharedCredentialsFiles)
+	}
+
+	if len(settings.AllowedAccountIds) > 0 {
+		args.AllowedAccountIds = pulumi.ToStringArray(settings.AllowedAccountIds)
+	}
+
+	if len(settings.ForbiddenAccountIds) > 0 {
+		args.ForbiddenAccountIds = pulumi.ToStringArray(settings.ForbiddenAccountIds)
+	}
+
+	if len(settings.AssumeRoles) > 0 {
+		roles := awsprovider.ProviderAssumeRoleArray{}
+		for _, role := range settings.AssumeRoles {
+			roleArgs := awsprovider.ProviderAssumeRoleArgs{
+				RoleArn:        optionalString(role.RoleArn),
+				SessionName:    optionalString(role.SessionName),
+				ExternalId:     optionalString(role.ExternalId),
+				Duration:       optionalString(role.Duration),
+				Policy:         optionalString(role.Policy),
+				SourceIdentity: optionalString(role.SourceIdentity),
+			}
+
+			if len(role.PolicyArns) > 0 {
+				roleArgs.PolicyArns = pulumi.ToStringArray(role.PolicyArns)
+			}
+
+			if len(role.Tags) > 0 {
+				roleArgs.Tags = pulumi.ToStringMap(role.Tags)
+			}
+
+			if len(role.TransitiveTagKeys) > 0 {
+				roleArgs.TransitiveTagKeys = pulumi.ToStringArray(role.TransitiveTagKeys)
+			}
+
+			roles = append(roles, roleArgs)
+		}
+
+		args.AssumeRoles = roles
+	}
+
+	return args
+}
+
+func optionalString(value string) pulumi.StringPtrInput {
+	if value == "" {
+		return nil
+	}
+
+	return pulumi.String(value)
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAwsSdkConfigUsesStaticCredentials(t *testing.T) {
+	settings := &AwsSettings{
+		AccessKey: "AKIAEXAMPLE",
+		SecretKey: "secret",
+		Token:     "token",
+	}
+
+	cfg, err := NewAwsSdkConfig(context.Background(), settings, "eu-west-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Region != "eu-west-1" {
+		t.Fatalf("expected region eu-west-1, got %s", cfg.Region)
+	}
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if creds.AccessKeyID != "AKIAEXAMPLE" || creds.SecretAccessKey != "secret" || creds.SessionToken != "token" {
+		t.Fatalf("expected the static credentials from the settings, got %s", creds.AccessKeyID)
+	}
+}
+
+func TestAwsSdkConfigRejectsInvalidAssumeRoleDuration(t *testing.T) {
+	settings := &AwsSettings{
+		AccessKey: "AKIAEXAMPLE",
+		SecretKey: "secret",
+		AssumeRoles: []AwsAssumeRole{
+			{RoleArn: "arn:aws:iam::123456789012:role/deploy", Duration: "an hour"},
+		},
+	}
+
+	_, err := NewAwsSdkConfig(context.Background(), settings, "us-east-1")
+	if err == nil || !strings.Contains(err.Error(), "arn:aws:iam::123456789012:role/deploy") {
+		t.Fatalf("expected an error naming the role, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// CidrSubnet calculates a subnet address within the given IPv4 CIDR block.
+// newBits is the number of bits to extend the prefix by and netNum is the subnet number to select.
+// eg- CidrSubnet("10.0.0.0/16", 4, 2) returns "10.0.32.0/20"
+func CidrSubnet(base string, newBits int, netNum int) (string, error) {
+	_, network, err := net.ParseCIDR(base)
+	if err != nil {
+		return "", err
+	}
+
+	if network.IP.To4() == nil {
+		return "", fmt.Errorf("only IPv4 CIDR blocks are supported: %s", base)
+	}
+
+	prefix, _ := network.Mask.Size()
+	newPrefix := prefix + newBits
+	if newBits < 0 || newPrefix > 32 {
+		return "", fmt.Errorf("cannot extend prefix of %s by %d bits", base, newBits)
+	}
+
+	if netNum < 0 || netNum >= 1<<newBits {
+		return "", fmt.Errorf("subnet number %d does not fit within %d additional bits of %s", netNum, newBits, base)
+	}
+
+	ip := new(big.Int).SetBytes(network.IP.To4())
+	ip.Or(ip, new(big.Int).Lsh(big.NewInt(int64(netNum)), uint(32-newPrefix)))
+
+	subnetIp := make(net.IP, 4)
+	ip.FillBytes(subnetIp)
+
+	return fmt.Sprintf("%s/%d", subnetIp.String(), newPrefix), nil
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestCidrSubnet(t *testing.T) {
+	res, err := CidrSubnet("10.0.0.0/16", 4, 0)
+	if err != nil || res != "10.0.0.0/20" {
+		t.Fatalf("expected 10.0.0.0/20, got %s (%v)", res, err)
+	}
+
+	res, err = CidrSubnet("10.0.0.0/16", 4, 2)
+	if err != nil || res != "10.0.32.0/20" {
+		t.Fatalf("expected 10.0.32.0/20, got %s (%v)", res, err)
+	}
+
+	res, err = CidrSubnet("172.16.0.0/20", 4, 15)
+	if err != nil || res != "172.16.15.0/24" {
+		t.Fatalf("expected 172.16.15.0/24, got %s (%v)", res, err)
+	}
+}
+
+func TestCidrSubnetInvalid(t *testing.T) {
+	if _, err := CidrSubnet("10.0.0.0/30", 4, 0); err == nil {
+		t.Fatalf("prefix longer than /32 should fail")
+	}
+
+	if _, err := CidrSubnet("10.0.0.0/16", 4, 16); err == nil {
+		t.Fatalf("subnet number outside of the new bits should fail")
+	}
+
+	if _, err := CidrSubnet("not-a-cidr", 4, 0); err == nil {
+		t.Fatalf("invalid CIDR should fail")
+	}
+}
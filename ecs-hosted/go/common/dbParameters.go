@@ -0,0 +1,85 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Aurora MySQL 8.0 parameters that may be overridden through config.
+// The value is true for static parameters, which only take effect after the instances are rebooted.
+var AuroraInstanceParameters = map[string]bool{
+	"general_log":                   false,
+	"innodb_lock_wait_timeout":      false,
+	"innodb_print_all_deadlocks":    false,
+	"interactive_timeout":           false,
+	"log_output":                    false,
+	"log_queries_not_using_indexes": false,
+	"long_query_time":               false,
+	"max_allowed_packet":            false,
+	"max_connections":               false,
+	"max_heap_table_size":           false,
+	"performance_schema":            true,
+	"slow_query_log":                false,
+	"sql_mode":                      false,
+	"table_open_cache":              false,
+	"tmp_table_size":                false,
+	"wait_timeout":                  false,
+}
+
+var AuroraClusterParameters = map[string]bool{
+	"aurora_parallel_query":          false,
+	"binlog_checksum":                false,
+	"binlog_format":                  true,
+	"binlog_row_image":               false,
+	"character_set_server":           false,
+	"collation_server":               false,
+	"innodb_autoinc_lock_mode":       true,
+	"innodb_flush_log_at_trx_commit": false,
+	"innodb_lock_wait_timeout":       false,
+	"innodb_print_all_deadlocks":     false,
+	"require_secure_transport":       false,
+	"server_audit_events":            false,
+	"server_audit_logging":           false,
+	"time_zone":                      false,
+	"tls_version":                    true,
+}
+
+// ValidateDbParameters makes sure every parameter is in the allowed set, reporting all unknown keys at once.
+// kind is used in the error message, eg- "dbClusterParameters"
+func ValidateDbParameters(kind string, parameters map[string]string, allowed map[string]bool) error {
+	var unknown []string
+	for name := range parameters {
+		if _, ok := allowed[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	var known []string
+	for name := range allowed {
+		known = append(known, name)
+	}
+
+	sort.Strings(unknown)
+	sort.Strings(known)
+
+	return fmt.Errorf("%s contains unsupported parameters: %s. Supported parameters are: %s", kind, strings.Join(unknown, ", "), strings.Join(known, ", "))
+}
+
+// MergeDbParameters returns the defaults with the overrides applied on top, leaving both inputs untouched
+func MergeDbParameters(defaults map[string]string, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(defaults)+len(overrides))
+	for name, value := range defaults {
+		merged[name] = value
+	}
+
+	for name, value := range overrides {
+		merged[name] = value
+	}
+
+	return merged
+}
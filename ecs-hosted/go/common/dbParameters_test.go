@@ -0,0 +1,35 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDbParameters(t *testing.T) {
+	err := ValidateDbParameters("dbInstanceParameters", map[string]string{"general_log": "0", "long_query_time": "2"}, AuroraInstanceParameters)
+	if err != nil {
+		t.Fatalf("expected known parameters to be valid, got %v", err)
+	}
+
+	err = ValidateDbParameters("dbClusterParameters", map[string]string{"binlog_format": "ROW", "innodb_bogus": "1", "aaa": "1"}, AuroraClusterParameters)
+	if err == nil {
+		t.Fatalf("expected unknown parameters to fail")
+	}
+
+	if !strings.Contains(err.Error(), "dbClusterParameters contains unsupported parameters: aaa, innodb_bogus.") {
+		t.Fatalf("expected all unknown parameters in sorted order, got %v", err)
+	}
+}
+
+func TestMergeDbParameters(t *testing.T) {
+	defaults := map[string]string{"general_log": "1", "slow_query_log": "1"}
+	merged := MergeDbParameters(defaults, map[string]string{"general_log": "0", "max_connections": "500"})
+
+	if len(merged) != 3 || merged["general_log"] != "0" || merged["slow_query_log"] != "1" || merged["max_connections"] != "500" {
+		t.Fatalf("unexpected merge result %v", merged)
+	}
+
+	if defaults["general_log"] != "1" {
+		t.Fatalf("defaults should not be modified")
+	}
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// metric names double as resource names, so they are kept to characters both accept
+var logMetricName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]{0,254}$`)
+
+// CloudWatch Logs rejects longer filter patterns
+const maxLogFilterPatternLength = 1024
+
+// API log lines that count as errors; the service writes both logfmt and JSON lines
+var defaultLogMetricFilters = map[string]string{
+	"ApiErrors":         `?"level=error" ?"\"level\":\"error\""`,
+	"ApiPanics":         `"panic:"`,
+	"ApiDatabaseErrors": `?"Error 1040" ?"Error 1205" ?"Error 1213" ?"driver: bad connection"`,
+}
+
+// LogMetricFilters returns the default metric filters with the overrides applied on top, keyed by metric name.
+// An empty pattern removes a default filter.
+func LogMetricFilters(overrides map[string]string) (map[string]string, error) {
+	merged := make(map[string]string, len(defaultLogMetricFilters)+len(overrides))
+	for name, pattern := range defaultLogMetricFilters {
+		merged[name] = pattern
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		pattern := overrides[name]
+		if pattern == "" {
+			delete(merged, name)
+			continue
+		}
+
+		if !logMetricName.MatchString(name) {
+			return nil, fmt.Errorf("logMetricFilters: %q must start with a letter and contain only letters, numbers, '.', '_' and '-'", name)
+		}
+
+		if len(pattern) > maxLogFilterPatternLength {
+			return nil, fmt.Errorf("logMetricFilters: the pattern of %s is longer than %d characters", name, maxLogFilterPatternLength)
+		}
+
+		merged[name] = pattern
+	}
+
+	return merged, nil
+}
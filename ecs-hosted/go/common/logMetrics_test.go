@@ -0,0 +1,37 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestLogMetricFilters(t *testing.T) {
+	filters, err := LogMetricFilters(map[string]string{
+		"ApiPanics":      "",
+		"ApiErrors":      `"ERROR"`,
+		"ApiRateLimited": `"429"`,
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := filters["ApiPanics"]; ok {
+		t.Fatalf("expected an empty pattern to remove the default, got %v", filters)
+	}
+
+	if filters["ApiErrors"] != `"ERROR"` || filters["ApiRateLimited"] != `"429"` {
+		t.Fatalf("expected overrides to be applied, got %v", filters)
+	}
+
+	if filters["ApiDatabaseErrors"] != defaultLogMetricFilters["ApiDatabaseErrors"] {
+		t.Fatalf("expected untouched defaults to remain, got %v", filters)
+	}
+}
+
+func TestLogMetricFiltersInvalid(t *testing.T) {
+	for _, name := range []string{"1Errors", "Api:Errors", "Api Errors"} {
+		if _, err := LogMetricFilters(map[string]string{name: `"ERROR"`}); err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+}
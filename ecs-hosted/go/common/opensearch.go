@@ -0,0 +1,167 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var openSearchEngineVersion = regexp.MustCompile(`^OpenSearch_\d+\.\d+$`)
+
+// OpenSearchDomainOptions are the node, storage and tiering settings of a managed OpenSearch domain.
+type OpenSearchDomainOptions struct {
+	EngineVersion        string
+	InstanceType         string
+	DedicatedMasterCount int
+	DedicatedMasterType  string
+	VolumeType           string
+	VolumeSize           int
+	VolumeIops           int
+	VolumeThroughput     int
+	WarmCount            int
+	WarmType             string
+	ColdStorage          bool
+}
+
+// ValidateOpenSearchDomain checks the combinations of domain settings that OpenSearch would otherwise reject part way through an update.
+// A zero IOPS or throughput means the volume type's default.
+func ValidateOpenSearchDomain(o OpenSearchDomainOptions) []string {
+	var problems []string
+
+	if !openSearchEngineVersion.MatchString(o.EngineVersion) {
+		problems = append(problems, fmt.Sprintf("openSearchEngineVersion must look like OpenSearch_2.13, not %s", o.EngineVersion))
+	}
+
+	if o.DedicatedMasterType != "" && o.DedicatedMasterCount == 0 {
+		problems = append(problems, "openSearchDedicatedMasterType requires openSearchDedicatedMasterCount")
+	}
+
+	if o.VolumeSize < 10 {
+		problems = append(problems, fmt.Sprintf("openSearchVolumeSize must be at least 10 GiB, not %d", o.VolumeSize))
+	}
+
+	switch o.VolumeType {
+	case "gp3":
+		if o.VolumeIops != 0 && (o.VolumeIops < 3000 || o.VolumeIops > 16000) {
+			problems = append(problems, fmt.Sprintf("openSearchVolumeIops must be between 3000 and 16000 for gp3, not %d", o.VolumeIops))
+		}
+
+		if o.VolumeThroughput != 0 && (o.VolumeThroughput < 125 || o.VolumeThroughput > 1000) {
+			problems = append(problems, fmt.Sprintf("openSearchVolumeThroughput must be between 125 and 1000 MiB/s for gp3, not %d", o.VolumeThroughput))
+		}
+	case "io1":
+		if o.VolumeIops < 1000 || o.VolumeIops > 16000 {
+			problems = append(problems, fmt.Sprintf("openSearchVolumeIops is required for io1 and must be between 1000 and 16000, not %d", o.VolumeIops))
+		}
+
+		if o.VolumeThroughput != 0 {
+			problems = append(problems, "openSearchVolumeThroughput is only supported for gp3 volumes")
+		}
+	case "gp2", "standard":
+		if o.VolumeIops != 0 || o.VolumeThroughput != 0 {
+			problems = append(problems, fmt.Sprintf("openSearchVolumeIops and openSearchVolumeThroughput are not supported for %s volumes", o.VolumeType))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("openSearchVolumeType must be gp3, gp2, io1 or standard, not %s", o.VolumeType))
+	}
+
+	if o.WarmCount > 0 {
+		if o.WarmCount < 2 || o.WarmCount > 150 {
+			problems = append(problems, fmt.Sprintf("openSearchWarmCount must be between 2 and 150, not %d", o.WarmCount))
+		}
+
+		if !strings.HasPrefix(o.WarmType, "ultrawarm1.") {
+			problems = append(problems, fmt.Sprintf("openSearchWarmType must be an UltraWarm instance type, eg- ultrawarm1.medium.search, not %s", o.WarmType))
+		}
+
+		if o.DedicatedMasterCount == 0 {
+			problems = append(problems, "UltraWarm requires dedicated master nodes; set openSearchDedicatedMasterCount")
+		}
+
+		if strings.HasPrefix(o.InstanceType, "t2.") || strings.HasPrefix(o.InstanceType, "t3.") {
+			problems = append(problems, fmt.Sprintf("UltraWarm is not supported with burstable data nodes (%s)", o.InstanceType))
+		}
+	}
+
+	if o.ColdStorage && o.WarmCount == 0 {
+		problems = append(problems, "openSearchEnableColdStorage requires UltraWarm; set openSearchWarmCount")
+	}
+
+	return problems
+}
+
+// ValidateOpenSearchSnapshots checks the snapshot and index lifecycle settings; indexes must roll over before they expire.
+func ValidateOpenSearchSnapshots(retentionCount int, rolloverDays int, indexRetentionDays int) []string {
+	var problems []string
+
+	if retentionCount < 1 {
+		problems = append(problems, fmt.Sprintf("openSearchSnapshotRetentionCount must be at least 1, not %d", retentionCount))
+	}
+
+	if rolloverDays < 1 {
+		problems = append(problems, fmt.Sprintf("openSearchRolloverDays must be at least 1, not %d", rolloverDays))
+	}
+
+	if indexRetentionDays <= rolloverDays {
+		problems = append(problems, fmt.Sprintf("openSearchIndexRetentionDays (%d) must be greater than openSearchRolloverDays (%d)", indexRetentionDays, rolloverDays))
+	}
+
+	return problems
+}
+
+// OpenSearchSnapshotPolicy returns a snapshot management policy that snapshots every index but the security index on the cron schedule
+// and keeps the newest retentionCount snapshots. Snapshots are pruned an hour after each run.
+func OpenSearchSnapshotPolicy(repository string, schedule string, retentionCount int) map[string]any {
+	return map[string]any{
+		"description": "Scheduled snapshots managed by the Pulumi self-hosted installer",
+		"creation": map[string]any{
+			"schedule": map[string]any{
+				"cron": map[string]any{"expression": schedule, "timezone": "UTC"},
+			},
+		},
+		"deletion": map[string]any{
+			"schedule": map[string]any{
+				"cron": map[string]any{"expression": "0 * * * *", "timezone": "UTC"},
+			},
+			"condition": map[string]any{"max_count": retentionCount, "min_count": 1},
+		},
+		"snapshot_config": map[string]any{
+			"repository":  repository,
+			"indices":     "*,-.opendistro_security",
+			"date_format": "yyyy-MM-dd-HH-mm",
+		},
+	}
+}
+
+// OpenSearchIsmPolicy returns an index state management policy that rolls indexes over after rolloverDays and deletes them after retentionDays.
+// The policy is attached to new indexes matching indexPatterns; without patterns it has to be attached by hand.
+func OpenSearchIsmPolicy(indexPatterns []string, rolloverDays int, retentionDays int) map[string]any {
+	policy := map[string]any{
+		"description":   "Index rollover and expiry managed by the Pulumi self-hosted installer",
+		"default_state": "hot",
+		"states": []map[string]any{
+			{
+				"name": "hot",
+				"actions": []map[string]any{
+					{"rollover": map[string]any{"min_index_age": fmt.Sprintf("%dd", rolloverDays)}},
+				},
+				"transitions": []map[string]any{
+					{"state_name": "delete", "conditions": map[string]any{"min_index_age": fmt.Sprintf("%dd", retentionDays)}},
+				},
+			},
+			{
+				"name":        "delete",
+				"actions":     []map[string]any{{"delete": map[string]any{}}},
+				"transitions": []map[string]any{},
+			},
+		},
+	}
+
+	if len(indexPatterns) > 0 {
+		policy["ism_template"] = []map[string]any{
+			{"index_patterns": indexPatterns, "priority": 100},
+		}
+	}
+
+	return map[string]any{"policy": policy}
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// collection and security policy names share the same rules
+var openSearchCollectionName = regexp.MustCompile(`^[a-z][a-z0-9-]{2,31}$`)
+
+// the VPC endpoint and security policies are named after the collection with a -vpc, -enc, -net or -api suffix
+const openSearchPolicySuffixLength = 4
+
+// ValidateOpenSearchCollectionName checks that a serverless collection, and the policies named after it, can use the name.
+func ValidateOpenSearchCollectionName(name string) error {
+	if !openSearchCollectionName.MatchString(name) || len(name)+openSearchPolicySuffixLength > 32 {
+		return fmt.Errorf("openSearchDomainName %q must start with a lowercase letter, contain only lowercase letters, numbers and hyphens, and be 3 to %d characters for a serverless collection", name, 32-openSearchPolicySuffixLength)
+	}
+
+	return nil
+}
+
+// OpenSearchEncryptionPolicy returns the encryption policy of a collection. An empty kmsKeyArn uses an AWS owned key.
+func OpenSearchEncryptionPolicy(collection string, kmsKeyArn string) map[string]any {
+	policy := map[string]any{
+		"Rules": []map[string]any{
+			{"ResourceType": "collection", "Resource": []string{fmt.Sprintf("collection/%s", collection)}},
+		},
+	}
+
+	if kmsKeyArn == "" {
+		policy["AWSOwnedKey"] = true
+	} else {
+		policy["KmsARN"] = kmsKeyArn
+	}
+
+	return policy
+}
+
+// OpenSearchNetworkPolicy returns a network policy that only allows access to a collection through the given VPC endpoint.
+func OpenSearchNetworkPolicy(collection string, vpcEndpointId string) []map[string]any {
+	return []map[string]any{
+		{
+			"Rules": []map[string]any{
+				{"ResourceType": "collection", "Resource": []string{fmt.Sprintf("collection/%s", collection)}},
+			},
+			"AllowFromPublic": false,
+			"SourceVPCEs":     []string{vpcEndpointId},
+		},
+	}
+}
+
+// OpenSearchDataAccessPolicy returns a data access policy that lets the principals manage the indexes of a collection, but not the collection itself.
+func OpenSearchDataAccessPolicy(collection string, principals []string) []map[string]any {
+	return []map[string]any{
+		{
+			"Rules": []map[string]any{
+				{
+					"ResourceType": "collection",
+					"Resource":     []string{fmt.Sprintf("collection/%s", collection)},
+					"Permission":   []string{"aoss:DescribeCollectionItems"},
+				},
+				{
+					"ResourceType": "index",
+					"Resource":     []string{fmt.Sprintf("index/%s/*", collection)},
+					"Permission":   []string{"aoss:*"},
+				},
+			},
+			"Principal": principals,
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestValidateOpenSearchCollectionName(t *testing.T) {
+	for _, name := range []string{"pulumi", "pulumi-search-2", "abc"} {
+		if err := ValidateOpenSearchCollectionName(name); err != nil {
+			t.Fatalf("expected %s to be valid, got %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"Pulumi", "2pulumi", "pu", "pulumi_search", "pulumi-search-collection-name"} {
+		if err := ValidateOpenSearchCollectionName(name); err == nil {
+			t.Fatalf("expected %s to be invalid", name)
+		}
+	}
+}
+
+func TestOpenSearchEncryptionPolicy(t *testing.T) {
+	policy := OpenSearchEncryptionPolicy("pulumi", "")
+	if policy["AWSOwnedKey"] != true {
+		t.Fatalf("expected an AWS owned key without a KMS key, got %v", policy)
+	}
+
+	policy = OpenSearchEncryptionPolicy("pulumi", "arn:aws:kms:us-east-1:123456789012:key/abc")
+	if _, ok := policy["AWSOwnedKey"]; ok || policy["KmsARN"] != "arn:aws:kms:us-east-1:123456789012:key/abc" {
+		t.Fatalf("expected the customer managed key, got %v", policy)
+	}
+}
+
+func TestOpenSearchDataAccessPolicy(t *testing.T) {
+	policy := OpenSearchDataAccessPolicy("pulumi", []string{"arn:aws:iam::123456789012:role/api"})
+	rules := policy[0]["Rules"].([]map[string]any)
+
+	if resource := rules[1]["Resource"].([]string)[0]; resource != "index/pulumi/*" {
+		t.Fatalf("expected index access to be scoped to the collection, got %s", resource)
+	}
+}
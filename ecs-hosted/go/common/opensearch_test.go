@@ -0,0 +1,109 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func validOpenSearchDomain() OpenSearchDomainOptions {
+	return OpenSearchDomainOptions{
+		EngineVersion: "OpenSearch_2.13",
+		InstanceType:  "t3.medium.search",
+		VolumeType:    "gp2",
+		VolumeSize:    10,
+	}
+}
+
+func TestValidateOpenSearchDomain(t *testing.T) {
+	if problems := ValidateOpenSearchDomain(validOpenSearchDomain()); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	tiered := OpenSearchDomainOptions{
+		EngineVersion:        "OpenSearch_2.17",
+		InstanceType:         "r6g.large.search",
+		DedicatedMasterCount: 3,
+		DedicatedMasterType:  "m6g.large.search",
+		VolumeType:           "gp3",
+		VolumeSize:           500,
+		VolumeIops:           6000,
+		VolumeThroughput:     250,
+		WarmCount:            2,
+		WarmType:             "ultrawarm1.medium.search",
+		ColdStorage:          true,
+	}
+
+	if problems := ValidateOpenSearchDomain(tiered); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateOpenSearchDomainStorage(t *testing.T) {
+	cases := map[string]func(o *OpenSearchDomainOptions){
+		"openSearchVolumeSize":                    func(o *OpenSearchDomainOptions) { o.VolumeSize = 5 },
+		"openSearchVolumeType":                    func(o *OpenSearchDomainOptions) { o.VolumeType = "st1" },
+		"not supported for gp2":                   func(o *OpenSearchDomainOptions) { o.VolumeIops = 3000 },
+		"required for io1":                        func(o *OpenSearchDomainOptions) { o.VolumeType = "io1" },
+		"between 125 and 1000":                    func(o *OpenSearchDomainOptions) { o.VolumeType = "gp3"; o.VolumeThroughput = 2000 },
+		"openSearchEngineVersion":                 func(o *OpenSearchDomainOptions) { o.EngineVersion = "2.13" },
+		"requires openSearchDedicatedMasterCount": func(o *OpenSearchDomainOptions) { o.DedicatedMasterType = "m6g.large.search" },
+	}
+
+	for expected, mutate := range cases {
+		o := validOpenSearchDomain()
+		mutate(&o)
+
+		problems := ValidateOpenSearchDomain(o)
+		if len(problems) != 1 || !strings.Contains(problems[0], expected) {
+			t.Fatalf("expected a single problem mentioning %q, got %v", expected, problems)
+		}
+	}
+}
+
+func TestValidateOpenSearchDomainTiering(t *testing.T) {
+	o := validOpenSearchDomain()
+	o.WarmCount = 1
+	o.WarmType = "r6g.large.search"
+	o.ColdStorage = true
+
+	// count, type, missing masters and burstable data nodes
+	if problems := ValidateOpenSearchDomain(o); len(problems) != 4 {
+		t.Fatalf("expected 4 problems, got %v", problems)
+	}
+
+	o = validOpenSearchDomain()
+	o.ColdStorage = true
+
+	problems := ValidateOpenSearchDomain(o)
+	if len(problems) != 1 || !strings.Contains(problems[0], "requires UltraWarm") {
+		t.Fatalf("expected cold storage to require UltraWarm, got %v", problems)
+	}
+}
+
+func TestValidateOpenSearchSnapshots(t *testing.T) {
+	if problems := ValidateOpenSearchSnapshots(14, 7, 90); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	if problems := ValidateOpenSearchSnapshots(0, 0, 0); len(problems) != 3 {
+		t.Fatalf("expected 3 problems, got %v", problems)
+	}
+}
+
+func TestOpenSearchIsmPolicy(t *testing.T) {
+	policy := OpenSearchIsmPolicy(nil, 7, 90)["policy"].(map[string]any)
+	if _, ok := policy["ism_template"]; ok {
+		t.Fatalf("policy without index patterns should not have an ism_template")
+	}
+
+	states := policy["states"].([]map[string]any)
+	transition := states[0]["transitions"].([]map[string]any)[0]
+	if transition["conditions"].(map[string]any)["min_index_age"] != "90d" {
+		t.Fatalf("expected indexes to expire after 90d, got %v", transition)
+	}
+
+	policy = OpenSearchIsmPolicy([]string{"pulumi-*"}, 7, 90)["policy"].(map[string]any)
+	if _, ok := policy["ism_template"]; !ok {
+		t.Fatalf("expected an ism_template for index patterns")
+	}
+}
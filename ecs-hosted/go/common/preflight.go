@@ -0,0 +1,109 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// private ECR images, eg- 123456789012.dkr.ecr.us-east-1.amazonaws.com/opensearch:2.19.1
+var privateEcrImagePattern = regexp.MustCompile(`^[0-9]{12}\.dkr\.ecr\.[a-z0-9-]+\.amazonaws\.com(\.cn)?/`)
+
+// PreflightReport collects the problems found while checking deployment inputs so they can be reported together
+// instead of failing on the first one halfway through an update.
+type PreflightReport struct {
+	problems []string
+}
+
+func (r *PreflightReport) Addf(format string, args ...any) {
+	r.problems = append(r.problems, fmt.Sprintf(format, args...))
+}
+
+func (r *PreflightReport) AddAll(problems []string) {
+	r.problems = append(r.problems, problems...)
+}
+
+// Err returns nil when no problems were found, otherwise a single error listing every problem.
+func (r *PreflightReport) Err() error {
+	if len(r.problems) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "preflight checks found %d problem(s); fix the following and run again:", len(r.problems))
+	for _, p := range r.problems {
+		fmt.Fprintf(&b, "\n  - %s", p)
+	}
+
+	return errors.New(b.String())
+}
+
+// ArnRegion returns the region of an ARN, eg- us-west-2 for arn:aws:kms:us-west-2:123456789012:key/abc
+func ArnRegion(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return "", fmt.Errorf("%s is not an ARN", arn)
+	}
+
+	return parts[3], nil
+}
+
+// CertificateCoversDomain reports whether any of the certificate's names match the domain.
+// A wildcard name only matches a single label, eg- *.example.com matches api.example.com but not api.dev.example.com
+func CertificateCoversDomain(certificateNames []string, domain string) bool {
+	domain = strings.ToLower(domain)
+	for _, name := range certificateNames {
+		name = strings.ToLower(name)
+		if name == domain {
+			return true
+		}
+
+		if strings.HasPrefix(name, "*.") {
+			label, rest, found := strings.Cut(domain, ".")
+			if found && label != "" && rest == name[2:] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ValidateOpenSearchTopology checks the domain layout against the subnets it will be placed in.
+// OpenSearch places one subnet per availability zone and zone awareness supports 2 or 3 zones.
+func ValidateOpenSearchTopology(subnetCount int, availabilityZoneCount int, instanceCount int, dedicatedMasterCount int) []string {
+	var problems []string
+
+	if subnetCount > instanceCount {
+		problems = append(problems, fmt.Sprintf("openSearchInstanceCount (%d) must be at least the number of private subnets (%d)", instanceCount, subnetCount))
+	}
+
+	if availabilityZoneCount != subnetCount {
+		problems = append(problems, fmt.Sprintf("OpenSearch needs each private subnet in a different availability zone; %d subnets span %d zones", subnetCount, availabilityZoneCount))
+	}
+
+	if subnetCount > 3 {
+		problems = append(problems, fmt.Sprintf("OpenSearch zone awareness supports at most 3 availability zones; %d private subnets were provided", subnetCount))
+	}
+
+	if subnetCount == 2 && instanceCount%2 != 0 {
+		problems = append(problems, fmt.Sprintf("openSearchInstanceCount (%d) must be even when the domain spans 2 availability zones", instanceCount))
+	}
+
+	if dedicatedMasterCount != 0 && dedicatedMasterCount != 3 && dedicatedMasterCount != 5 {
+		problems = append(problems, fmt.Sprintf("openSearchDedicatedMasterCount must be 0, 3 or 5, not %d", dedicatedMasterCount))
+	}
+
+	return problems
+}
+
+// ValidateNatlessImage checks that an image can be pulled without a NAT.
+// Only private ECR registries are reachable, through the ecr and S3 endpoints; public registries, including public.ecr.aws, are not.
+func ValidateNatlessImage(key string, image string) []string {
+	if privateEcrImagePattern.MatchString(image) {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s %s can't be pulled in natless mode; mirror it to a private ECR repository and set %s to it", key, image, key)}
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreflightReport(t *testing.T) {
+	var report PreflightReport
+	if report.Err() != nil {
+		t.Fatalf("empty report should not be an error")
+	}
+
+	report.Addf("subnet %s not found", "subnet-1")
+	report.AddAll([]string{"key disabled"})
+
+	err := report.Err()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if !strings.Contains(err.Error(), "2 problem(s)") || !strings.Contains(err.Error(), "\n  - subnet subnet-1 not found\n  - key disabled") {
+		t.Fatalf("unexpected report %q", err.Error())
+	}
+}
+
+func TestArnRegion(t *testing.T) {
+	region, err := ArnRegion("arn:aws:acm:us-west-2:123456789012:certificate/abc")
+	if err != nil || region != "us-west-2" {
+		t.Fatalf("expected us-west-2, got %s %v", region, err)
+	}
+
+	if _, err := ArnRegion("alias/pulumi"); err == nil {
+		t.Fatalf("alias should not parse as an ARN")
+	}
+}
+
+func TestCertificateCoversDomain(t *testing.T) {
+	names := []string{"example.com", "*.pulumi.example.com"}
+
+	cases := map[string]bool{
+		"example.com":            true,
+		"API.pulumi.example.com": true,
+		"api.example.com":        false,
+		"a.b.pulumi.example.com": false,
+		"pulumi.example.com":     false,
+	}
+
+	for domain, expected := range cases {
+		if CertificateCoversDomain(names, domain) != expected {
+			t.Fatalf("expected %v for %s", expected, domain)
+		}
+	}
+}
+
+func TestValidateOpenSearchTopology(t *testing.T) {
+	if problems := ValidateOpenSearchTopology(2, 2, 2, 0); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	if problems := ValidateOpenSearchTopology(3, 3, 3, 3); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	// more subnets than instances, subnets sharing a zone
+	if problems := ValidateOpenSearchTopology(3, 2, 2, 0); len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", problems)
+	}
+
+	if problems := ValidateOpenSearchTopology(2, 2, 3, 2); len(problems) != 2 {
+		t.Fatalf("expected odd instance count and master count problems, got %v", problems)
+	}
+
+	if problems := ValidateOpenSearchTopology(4, 4, 4, 0); len(problems) != 1 {
+		t.Fatalf("expected too many zones, got %v", problems)
+	}
+}
+
+func TestValidateNatlessImage(t *testing.T) {
+	for _, image := range []string{"123456789012.dkr.ecr.us-east-1.amazonaws.com/opensearch:2.19.1", "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn/fluent-bit:stable"} {
+		if problems := ValidateNatlessImage("image", image); len(problems) != 0 {
+			t.Fatalf("expected %s to be pullable, got %v", image, problems)
+		}
+	}
+
+	for _, image := range []string{"public.ecr.aws/opensearchproject/opensearch:2.19.1", "opensearchproject/opensearch:2.19.1", "ghcr.io/fluent/fluent-bit:3.0"} {
+		if problems := ValidateNatlessImage("image", image); len(problems) != 1 {
+			t.Fatalf("expected %s to be rejected, got %v", image, problems)
+		}
+	}
+}
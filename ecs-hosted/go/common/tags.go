@@ -0,0 +1,152 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// AWS limits on user defined tags
+const maxResourceTags = 50
+const maxTagKeyLength = 128
+const maxTagValueLength = 256
+
+// MergeTags combines the stack's base tags with the user defined tags from config.
+// Base tags cannot be overridden; cost allocation reports rely on them.
+func MergeTags(base map[string]string, tags map[string]string) (map[string]string, error) {
+	merged := map[string]string{}
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := tags[k]
+
+		if _, ok := base[k]; ok {
+			return nil, fmt.Errorf("tag %s is set by the installer and cannot be overridden", k)
+		}
+
+		if k == "" || len(k) > maxTagKeyLength || len(v) > maxTagValueLength {
+			return nil, fmt.Errorf("tag %q must have a key of 1 to %d characters and a value of at most %d characters", k, maxTagKeyLength, maxTagValueLength)
+		}
+
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return nil, fmt.Errorf("tag %s uses the reserved aws: prefix", k)
+		}
+
+		merged[k] = v
+	}
+
+	if len(merged) > maxResourceTags {
+		return nil, fmt.Errorf("at most %d tags can be applied, including the installer's %d base tags", maxResourceTags, len(base))
+	}
+
+	return merged, nil
+}
+
+// AWS resource types created by the installers that accept a tags property; the provider rejects tags on any other type
+var taggableResourceTypes = map[string]bool{
+	"aws:appautoscaling/target:Target":                             true,
+	"aws:cloudwatch/logGroup:LogGroup":                             true,
+	"aws:ec2/eip:Eip":                                              true,
+	"aws:ec2/internetGateway:InternetGateway":                      true,
+	"aws:ec2/natGateway:NatGateway":                                true,
+	"aws:ec2/routeTable:RouteTable":                                true,
+	"aws:ec2/securityGroup:SecurityGroup":                          true,
+	"aws:ec2/subnet:Subnet":                                        true,
+	"aws:ec2/vpc:Vpc":                                              true,
+	"aws:ec2/vpcEndpoint:VpcEndpoint":                              true,
+	"aws:ecs/cluster:Cluster":                                      true,
+	"aws:ecs/service:Service":                                      true,
+	"aws:ecs/taskDefinition:TaskDefinition":                        true,
+	"aws:efs/accessPoint:AccessPoint":                              true,
+	"aws:efs/fileSystem:FileSystem":                                true,
+	"aws:iam/role:Role":                                            true,
+	"aws:kinesis/firehoseDeliveryStream:FirehoseDeliveryStream":    true,
+	"aws:kms/key:Key":                                              true,
+	"aws:lambda/function:Function":                                 true,
+	"aws:lb/listener:Listener":                                     true,
+	"aws:lb/listenerRule:ListenerRule":                             true,
+	"aws:lb/loadBalancer:LoadBalancer":                             true,
+	"aws:lb/targetGroup:TargetGroup":                               true,
+	"aws:opensearch/domain:Domain":                                 true,
+	"aws:opensearch/serverlessCollection:ServerlessCollection":     true,
+	"aws:rds/cluster:Cluster":                                      true,
+	"aws:rds/clusterInstance:ClusterInstance":                      true,
+	"aws:rds/clusterParameterGroup:ClusterParameterGroup":          true,
+	"aws:rds/globalCluster:GlobalCluster":                          true,
+	"aws:rds/parameterGroup:ParameterGroup":                        true,
+	"aws:rds/proxy:Proxy":                                          true,
+	"aws:rds/subnetGroup:SubnetGroup":                              true,
+	"aws:s3/bucket:Bucket":                                         true,
+	"aws:secretsmanager/secret:Secret":                             true,
+	"aws:servicediscovery/privateDnsNamespace:PrivateDnsNamespace": true,
+	"aws:servicediscovery/service:Service":                         true,
+}
+
+// IsTaggableResourceType reports whether the installers tag resources of the given type
+func IsTaggableResourceType(resourceType string) bool {
+	return taggableResourceTypes[resourceType]
+}
+
+/*
+RegisterDefaultTags tags every taggable AWS resource in the stack, whichever provider it uses.
+A stack transform merges the tags into the resource's own tags property, so resources keep their provider and existing stacks only see a tags update.
+Tags a resource sets itself, eg- Name, are kept and win over the stack's tags.
+*/
+func RegisterDefaultTags(ctx *pulumi.Context, tags map[string]string) error {
+	return ctx.RegisterResourceTransform(func(_ context.Context, args *pulumi.ResourceTransformArgs) *pulumi.ResourceTransformResult {
+		if !args.Custom || !IsTaggableResourceType(args.Type) {
+			return nil
+		}
+
+		props := pulumi.Map{}
+		for k, v := range args.Props {
+			props[k] = v
+		}
+
+		if resourceTags, ok := args.Props["tags"]; ok {
+			props["tags"] = pulumi.All(resourceTags).ApplyT(func(values []any) map[string]any {
+				return MergeResourceTags(tags, values[0])
+			}).(pulumi.MapOutput)
+		} else {
+			props["tags"] = pulumi.ToStringMap(tags)
+		}
+
+		return &pulumi.ResourceTransformResult{
+			Props: props,
+			Opts:  args.Opts,
+		}
+	})
+}
+
+// MergeResourceTags applies the tags a resource sets itself over the stack's tags
+func MergeResourceTags(tags map[string]string, resourceTags any) map[string]any {
+	merged := map[string]any{}
+	for k, v := range tags {
+		merged[k] = v
+	}
+
+	switch t := resourceTags.(type) {
+	case map[string]string:
+		for k, v := range t {
+			merged[k] = v
+		}
+	case map[string]any:
+		for k, v := range t {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMergeTags(t *testing.T) {
+	base := map[string]string{"project": "infra", "stack": "prod"}
+
+	merged, err := MergeTags(base, map[string]string{"cost-center": "1234"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(merged) != 3 || merged["cost-center"] != "1234" || merged["stack"] != "prod" {
+		t.Fatalf("unexpected tags %v", merged)
+	}
+
+	merged, err = MergeTags(base, nil)
+	if err != nil || len(merged) != 2 {
+		t.Fatalf("expected only the base tags, got %v %v", merged, err)
+	}
+}
+
+func TestMergeTagsInvalid(t *testing.T) {
+	base := map[string]string{"project": "infra", "stack": "prod"}
+
+	if _, err := MergeTags(base, map[string]string{"stack": "dev"}); err == nil {
+		t.Fatalf("overriding a base tag should fail")
+	}
+
+	if _, err := MergeTags(base, map[string]string{"aws:createdBy": "me"}); err == nil {
+		t.Fatalf("reserved prefix should fail")
+	}
+
+	tags := map[string]string{}
+	for i := 0; i < maxResourceTags-1; i++ {
+		tags[fmt.Sprintf("tag-%d", i)] = "value"
+	}
+
+	if _, err := MergeTags(base, tags); err == nil {
+		t.Fatalf("too many tags should fail")
+	}
+}
+
+func TestIsTaggableResourceType(t *testing.T) {
+	if !IsTaggableResourceType("aws:rds/cluster:Cluster") || !IsTaggableResourceType("aws:s3/bucket:Bucket") {
+		t.Fatalf("clusters and buckets should be taggable")
+	}
+
+	for _, resourceType := range []string{"aws:iam/rolePolicy:RolePolicy", "aws:route53/record:Record", "pulumi:providers:aws", "random:index/randomId:RandomId"} {
+		if IsTaggableResourceType(resourceType) {
+			t.Fatalf("%s should not be taggable", resourceType)
+		}
+	}
+}
+
+func TestMergeResourceTags(t *testing.T) {
+	tags := map[string]string{"project": "infra", "stack": "prod"}
+
+	merged := MergeResourceTags(tags, map[string]any{"Name": "pulumi-vpc", "stack": "override"})
+	if len(merged) != 3 || merged["Name"] != "pulumi-vpc" || merged["stack"] != "override" || merged["project"] != "infra" {
+		t.Fatalf("unexpected tags %v", merged)
+	}
+
+	merged = MergeResourceTags(tags, map[string]string{"Name": "pulumi-subnet"})
+	if len(merged) != 3 || merged["Name"] != "pulumi-subnet" {
+		t.Fatalf("unexpected tags %v", merged)
+	}
+
+	merged = MergeResourceTags(tags, nil)
+	if len(merged) != 2 {
+		t.Fatalf("expected only the stack tags, got %v", merged)
+	}
+}
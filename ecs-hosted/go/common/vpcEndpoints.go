@@ -0,0 +1,139 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VpcEndpointService is an AWS service reachable through an interface VPC endpoint.
+// Service is the suffix of the endpoint service name, eg- ecr.api for com.amazonaws.{region}.ecr.api
+type VpcEndpointService struct {
+	Service      string
+	ResourceName string
+	Enabled      bool
+}
+
+// S3GatewayVpcEndpoint is the gateway endpoint the infrastructure stack always creates, keyed by its service in the exported vpcEndpointIds
+const S3GatewayVpcEndpoint = "s3"
+
+// DefaultVpcEndpoints is the catalog of interface endpoints the installer knows about.
+// Entries that are enabled are created unless disabled through config; the rest can be switched on.
+var DefaultVpcEndpoints = []VpcEndpointService{
+	{Service: "ecr.dkr", ResourceName: "ecr-dkr-endpoint", Enabled: true},
+	{Service: "ecr.api", ResourceName: "ecr-api-endpoint", Enabled: true},
+	{Service: "secretsmanager", ResourceName: "secrets-manager-endpoint", Enabled: true},
+	{Service: "logs", ResourceName: "cloudwatch-endpoint", Enabled: true},
+	{Service: "elasticloadbalancing", ResourceName: "elb-endpoint", Enabled: true},
+	{Service: "sts", ResourceName: "sts-endpoint"},
+	{Service: "kms", ResourceName: "kms-endpoint"},
+	{Service: "ssm", ResourceName: "ssm-endpoint"},
+	{Service: "ecs", ResourceName: "ecs-endpoint"},
+	{Service: "ecs-agent", ResourceName: "ecs-agent-endpoint"},
+	{Service: "ecs-telemetry", ResourceName: "ecs-telemetry-endpoint"},
+	{Service: "es", ResourceName: "es-endpoint"},
+	{Service: "monitoring", ResourceName: "monitoring-endpoint"},
+	{Service: "xray", ResourceName: "xray-endpoint"},
+}
+
+// NatlessVpcEndpoints are the services the API, console and migrations tasks call when the private subnets have no route to the internet.
+// S3 is reached through the gateway endpoint and is not included.
+var NatlessVpcEndpoints = []string{
+	// image manifests and auth; layers come from S3
+	"ecr.dkr",
+	"ecr.api",
+	// task definition secrets, including the database credentials
+	"secretsmanager",
+	// awslogs driver and the log router's own logs
+	"logs",
+	// task role credentials
+	"sts",
+	// the API encrypts secrets with kmsServiceKeyId
+	"kms",
+	// Fargate agent, container metadata and metrics
+	"ecs",
+	"ecs-agent",
+	"ecs-telemetry",
+	"xray",
+}
+
+// RequireVpcEndpoints returns a copy of the overrides with the required services switched on.
+// A required service that has been explicitly disabled is an error rather than being silently re-enabled.
+func RequireVpcEndpoints(overrides map[string]bool, required []string) (map[string]bool, error) {
+	result := map[string]bool{}
+	for service, enabled := range overrides {
+		result[service] = enabled
+	}
+
+	var disabled []string
+	for _, service := range required {
+		if enabled, ok := result[service]; ok && !enabled {
+			disabled = append(disabled, service)
+		}
+
+		result[service] = true
+	}
+
+	if len(disabled) > 0 {
+		return nil, fmt.Errorf("vpc endpoints %s are required and cannot be disabled", strings.Join(disabled, ", "))
+	}
+
+	return result, nil
+}
+
+// ResolveVpcEndpoints applies the enable/disable overrides to the catalog and appends any extra services.
+// Only enabled endpoints are returned, catalog entries first followed by extras in the order given.
+func ResolveVpcEndpoints(catalog []VpcEndpointService, overrides map[string]bool, extras []string) ([]VpcEndpointService, error) {
+	known := map[string]bool{}
+	for _, e := range catalog {
+		known[e.Service] = true
+	}
+
+	var unknown []string
+	for service := range overrides {
+		if !known[service] {
+			unknown = append(unknown, service)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown vpc endpoints: %s. Use extraVpcEndpoints to add services that are not in the catalog", strings.Join(unknown, ", "))
+	}
+
+	var endpoints []VpcEndpointService
+	for _, e := range catalog {
+		if enabled, ok := overrides[e.Service]; ok {
+			e.Enabled = enabled
+		}
+
+		if e.Enabled {
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, service := range extras {
+		if known[service] {
+			return nil, fmt.Errorf("vpc endpoint %s is already in the catalog; enable it through vpcEndpoints instead", service)
+		}
+
+		// an interface endpoint next to the gateway would cost money and lose its ID in the exported vpcEndpointIds
+		if service == S3GatewayVpcEndpoint {
+			return nil, fmt.Errorf("vpc endpoint %s is always created as a gateway endpoint and cannot be added as an interface endpoint", service)
+		}
+
+		if seen[service] || service == "" {
+			return nil, fmt.Errorf("extra vpc endpoint %q is empty or listed more than once", service)
+		}
+
+		seen[service] = true
+		endpoints = append(endpoints, VpcEndpointService{
+			Service:      service,
+			ResourceName: fmt.Sprintf("%s-endpoint", strings.ReplaceAll(service, ".", "-")),
+			Enabled:      true,
+		})
+	}
+
+	return endpoints, nil
+}
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestResolveVpcEndpointsDefaults(t *testing.T) {
+	endpoints, err := ResolveVpcEndpoints(DefaultVpcEndpoints, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []string{"ecr.dkr", "ecr.api", "secretsmanager", "logs", "elasticloadbalancing"}
+	if len(endpoints) != len(expected) {
+		t.Fatalf("expected %d endpoints, got %v", len(expected), endpoints)
+	}
+
+	for i, e := range endpoints {
+		if e.Service != expected[i] {
+			t.Fatalf("expected %s at %d, got %s", expected[i], i, e.Service)
+		}
+	}
+}
+
+func TestResolveVpcEndpointsOverrides(t *testing.T) {
+	endpoints, err := ResolveVpcEndpoints(DefaultVpcEndpoints, map[string]bool{"elasticloadbalancing": false, "kms": true}, []string{"ssmmessages"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	services := map[string]string{}
+	for _, e := range endpoints {
+		services[e.Service] = e.ResourceName
+	}
+
+	if _, ok := services["elasticloadbalancing"]; ok {
+		t.Fatalf("elasticloadbalancing should be disabled")
+	}
+
+	if services["kms"] != "kms-endpoint" || services["ssmmessages"] != "ssmmessages-endpoint" {
+		t.Fatalf("expected kms and ssmmessages endpoints, got %v", services)
+	}
+
+	if endpoints[len(endpoints)-1].Service != "ssmmessages" {
+		t.Fatalf("extras should follow the catalog entries")
+	}
+}
+
+func TestResolveVpcEndpointsInvalid(t *testing.T) {
+	if _, err := ResolveVpcEndpoints(DefaultVpcEndpoints, map[string]bool{"bogus": true}, nil); err == nil {
+		t.Fatalf("unknown catalog entry should fail")
+	}
+
+	if _, err := ResolveVpcEndpoints(DefaultVpcEndpoints, nil, []string{"kms"}); err == nil {
+		t.Fatalf("extra endpoint already in the catalog should fail")
+	}
+
+	if _, err := ResolveVpcEndpoints(DefaultVpcEndpoints, nil, []string{"ssmmessages", "ssmmessages"}); err == nil {
+		t.Fatalf("duplicate extra endpoint should fail")
+	}
+
+	if _, err := ResolveVpcEndpoints(DefaultVpcEndpoints, nil, []string{S3GatewayVpcEndpoint}); err == nil {
+		t.Fatalf("extra endpoint for the s3 gateway should fail")
+	}
+}
+
+// the natless list is what keeps the tasks working without a NAT; changes to it should be deliberate
+func TestNatlessVpcEndpoints(t *testing.T) {
+	expected := []string{"ecr.dkr", "ecr.api", "secretsmanager", "logs", "sts", "kms", "ecs", "ecs-agent", "ecs-telemetry", "xray"}
+	if len(NatlessVpcEndpoints) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, NatlessVpcEndpoints)
+	}
+
+	known := map[string]bool{}
+	for _, e := range DefaultVpcEndpoints {
+		known[e.Service] = true
+	}
+
+	for i, service := range NatlessVpcEndpoints {
+		if service != expected[i] {
+			t.Fatalf("expected %s at %d, got %s", expected[i], i, service)
+		}
+
+		if !known[service] {
+			t.Fatalf("natless endpoint %s is not in the catalog", service)
+		}
+	}
+
+	if known[S3GatewayVpcEndpoint] {
+		t.Fatalf("s3 is reached through the gateway endpoint and must not be an interface endpoint")
+	}
+}
+
+func TestRequireVpcEndpoints(t *testing.T) {
+	overrides := map[string]bool{"elasticloadbalancing": false}
+	required, err := RequireVpcEndpoints(overrides, NatlessVpcEndpoints)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(overrides) != 1 {
+		t.Fatalf("overrides should not be modified, got %v", overrides)
+	}
+
+	endpoints, err := ResolveVpcEndpoints(DefaultVpcEndpoints, required, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	services := map[string]bool{}
+	for _, e := range endpoints {
+		services[e.Service] = true
+	}
+
+	for _, service := range NatlessVpcEndpoints {
+		if !services[service] {
+			t.Fatalf("expected %s to be enabled, got %v", service, services)
+		}
+	}
+
+	if services["elasticloadbalancing"] {
+		t.Fatalf("elasticloadbalancing should stay disabled")
+	}
+
+	if _, err := RequireVpcEndpoints(map[string]bool{"kms": false}, NatlessVpcEndpoints); err == nil {
+		t.Fatalf("disabling a required endpoint should fail")
+	}
+}
@@ -68,6 +68,30 @@ func NewApplicationDns(ctx *pulumi.Context, name string, args *ApplicationDnsArg
 		return nil, err
 	}
 
+	// dashboards share the public load balancer with the API and console
+	if args.EnableOpenSearchDashboards {
+		dashboardsName := args.Domain.ApplyT(func(s string) string {
+			return strings.Join([]string{"dashboards", s}, ".")
+		}).(pulumi.StringOutput)
+
+		resource.DashboardsRecord, err = route53.NewRecord(ctx, fmt.Sprintf("%s-dashboards-record", name), &route53.RecordArgs{
+			ZoneId: zone.Id(),
+			Name:   dashboardsName,
+			Type:   pulumi.String("A"),
+			Aliases: &route53.RecordAliasArray{
+				route53.RecordAliasArgs{
+					Name:                 args.PublicLoadBalancerDnsName,
+					ZoneId:               args.PublicLoadBalancerZoneId,
+					EvaluateTargetHealth: pulumi.Bool(true),
+				},
+			},
+		}, options...)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if args.EnablePrivateLoadBalancerAndLimitEgress {
 		apiInternalName := args.Domain.ApplyT(func(s string) string {
 			return strings.Join([]string{"api-internal", s}, ".")
@@ -97,6 +121,7 @@ func NewApplicationDns(ctx *pulumi.Context, name string, args *ApplicationDnsArg
 type ApplicationDnsArgs struct {
 	Region                                  string
 	EnablePrivateLoadBalancerAndLimitEgress bool
+	EnableOpenSearchDashboards              bool
 	Domain                                  pulumi.StringOutput
 	ZoneName                                pulumi.StringOutput
 	PublicLoadBalancerDnsName               pulumi.StringOutput
@@ -111,4 +136,5 @@ type ApplicationDns struct {
 	ApiRecord         *route53.Record
 	ApiInternalRecord *route53.Record
 	ConsoleRecord     *route53.Record
+	DashboardsRecord  *route53.Record
 }
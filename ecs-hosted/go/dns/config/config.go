@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
 )
@@ -19,6 +22,7 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 
 	appConfig := config.New(ctx, "")
 	resource.EnablePrivateLoadBalancerAndLimitEgress = appConfig.GetBool("enablePrivateLoadBalancerAndLimitEgress")
+	resource.EnableOpenSearchDashboards = appConfig.GetBool("enableOpenSearchDashboards")
 
 	awsConfig := config.New(ctx, "aws")
 
@@ -28,6 +32,22 @@ func NewConfig(ctx *pulumi.Context) (*ConfigArgs, error) {
 	resource.ProjectName = ctx.Project()
 	resource.StackName = ctx.Stack()
 
+	// user defined tags are applied, along with the project and stack, to every taggable resource
+	var tags map[string]string
+	err = appConfig.GetObject("tags", &tags)
+	if err != nil {
+		return nil, fmt.Errorf("tags must be a map of tag keys to string values: %w", err)
+	}
+
+	resource.Tags, err = common.MergeTags(map[string]string{
+		"project": resource.ProjectName,
+		"stack":   resource.StackName,
+	}, tags)
+
+	if err != nil {
+		return nil, err
+	}
+
 	stackRef, err := pulumi.NewStackReference(ctx, appConfig.Require("appStackReference"), nil)
 	if err != nil {
 		return nil, err
@@ -51,7 +71,9 @@ type ConfigArgs struct {
 	AccountId                               string
 	ProjectName                             string
 	StackName                               string
+	Tags                                    map[string]string
 	EnablePrivateLoadBalancerAndLimitEgress bool
+	EnableOpenSearchDashboards              bool
 	Route53ZoneName                         pulumi.StringOutput
 	Route53Subdomain                        pulumi.StringOutput
 	PublicLoadBalancerDnsName               pulumi.StringOutput
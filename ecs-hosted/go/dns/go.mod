@@ -4,6 +4,7 @@ go 1.26.1
 
 require (
 	github.com/pulumi/pulumi-aws/sdk/v7 v7.43.0
+	github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure v0.0.0-00010101000000-000000000000
 	github.com/pulumi/pulumi/sdk/v3 v3.256.0
 )
 
@@ -113,3 +114,5 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	lukechampine.com/frand v1.5.1 // indirect
 )
+
+replace github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure => ../
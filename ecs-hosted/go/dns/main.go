@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/dns/config"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"strings"
 )
@@ -14,6 +15,11 @@ func main() {
 			return err
 		}
 
+		err = common.RegisterDefaultTags(ctx, cfg.Tags)
+		if err != nil {
+			return err
+		}
+
 		domain := pulumi.All(cfg.Route53ZoneName, cfg.Route53Subdomain).ApplyT(func(args []any) string {
 			zone := args[0].(string)
 			sub := args[1].(string)
@@ -34,6 +40,7 @@ func main() {
 			InternalLoadBalancerDnsName:             cfg.InternalLoadBalancerDnsName,
 			InternalLoadBalancerZoneId:              cfg.InternalLoadBalancerZoneId,
 			EnablePrivateLoadBalancerAndLimitEgress: cfg.EnablePrivateLoadBalancerAndLimitEgress,
+			EnableOpenSearchDashboards:              cfg.EnableOpenSearchDashboards,
 		})
 
 		if err != nil {
@@ -47,6 +54,10 @@ func main() {
 			ctx.Export("apiInternalUrl", dnsRecords.ApiInternalRecord.Fqdn)
 		}
 
+		if cfg.EnableOpenSearchDashboards {
+			ctx.Export("dashboardsUrl", dnsRecords.DashboardsRecord.Fqdn)
+		}
+
 		return nil
 	})
 }
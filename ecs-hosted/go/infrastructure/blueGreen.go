@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const blueEnvironment = "blue"
+const greenEnvironment = "green"
+
+/*
+Report which environment serves the cluster during an RDS Blue/Green Deployment upgrade.
+The deployment is created, switched over and deleted outside of pulumi, see Upgrading Aurora in the README; the program only reads it.
+Once switched over, green has taken over the cluster and instance identifiers and endpoints, and blue keeps running with an -old1 suffix until it is deleted.
+Returns the active environment, blue or green.
+*/
+func newBlueGreenStatus(ctx *pulumi.Context, args *DatabaseArgs, clusterIdentifier pulumi.StringOutput) pulumi.StringOutput {
+	return clusterIdentifier.ApplyT(func(clusterId string) (string, error) {
+		// look up the deployment as the same identity the provider deploys with
+		cfg, err := common.NewAwsSdkConfig(context.TODO(), args.awsSettings, args.region)
+		if err != nil {
+			return "", err
+		}
+
+		client := rds.NewFromConfig(cfg)
+
+		deploymentName := blueGreenDeploymentName(clusterId)
+		deployment, err := describeBlueGreenDeployment(client, deploymentName)
+		if err != nil {
+			return "", err
+		}
+
+		if deployment == nil {
+			return blueEnvironment, nil
+		}
+
+		status := aws.ToString(deployment.Status)
+		if status != "SWITCHOVER_COMPLETED" {
+			ctx.Log.Info(fmt.Sprintf("Blue/green deployment %s for Aurora cluster %s is %s", deploymentName, clusterId, status), nil)
+			return blueEnvironment, nil
+		}
+
+		ctx.Log.Warn(fmt.Sprintf("Aurora cluster %s was switched over by blue/green deployment %s. "+
+			"Delete the deployment and the %s-old1 cluster once the upgrade looks good.", clusterId, deploymentName, clusterId), nil)
+
+		return greenEnvironment, nil
+	}).(pulumi.StringOutput)
+}
+
+// the name the README's upgrade workflow gives the deployment
+func blueGreenDeploymentName(clusterId string) string {
+	return fmt.Sprintf("%s-upgrade", clusterId)
+}
+
+func describeBlueGreenDeployment(client *rds.Client, deploymentName string) (*types.BlueGreenDeployment, error) {
+	result, err := client.DescribeBlueGreenDeployments(context.TODO(), &rds.DescribeBlueGreenDeploymentsInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("blue-green-deployment-name"),
+				Values: []string{deploymentName},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.BlueGreenDeployments) == 0 {
+		return nil, nil
+	}
+
+	return &result.BlueGreenDeployments[0], nil
+}
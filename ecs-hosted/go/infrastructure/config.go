@@ -2,31 +2,90 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
 )
 
 type ConfigValues struct {
-	Region                         string
-	AccountId                      string
-	ProjectName                    string
-	CommonName                     string
-	VpcId                          string
-	Stack                          string
-	NumberDbReplicas               int
-	PublicSubnetIds                []string
-	PrivateSubnetIds               []string
-	IsolatedSubnetIds              []string
-	DbInstanceType                 string
-	BaseTags                       map[string]string
-	UseOpenSearchContainer         bool
-	EnableOpenSearch               bool
-	OpenSearchInstanceType         string
-	OpenSearchInstanceCount        int
-	OpenSearchDomainName           string
-	OpenSearchDedicatedMasterCount int
+	Region                           string
+	AwsSettings                      *common.AwsSettings
+	AccountId                        string
+	ProjectName                      string
+	CommonName                       string
+	VpcId                            string
+	Stack                            string
+	NumberDbReplicas                 int
+	DbReplicaInstanceTypes           []string
+	EnableDbReplicaAutoscaling       bool
+	DbReplicaAutoscalingMin          int
+	DbReplicaAutoscalingMax          int
+	DbReplicaAutoscalingTargetCpu    float64
+	PublicSubnetIds                  []string
+	PrivateSubnetIds                 []string
+	IsolatedSubnetIds                []string
+	DbInstanceType                   string
+	EnableDbServerless               bool
+	DbServerlessMinCapacity          float64
+	DbServerlessMaxCapacity          float64
+	EnableDbProxy                    bool
+	DbPasswordRotationDays           int
+	RestoreFromSnapshotIdentifier    string
+	DbEngineVersion                  string
+	DbBlueGreenUpgrade               bool
+	DbInstanceParameters             map[string]string
+	DbClusterParameters              map[string]string
+	DbDrRegion                       string
+	DbDrVpcId                        string
+	DbDrSubnetIds                    []string
+	DbDrKmsKeyArn                    string
+	UseExistingDb                    bool
+	ExistingDbEndpoint               string
+	ExistingDbPort                   int
+	ExistingDbName                   string
+	ExistingDbUsername               string
+	ExistingDbSecurityGroupId        string
+	ExistingDbCredentialsSecretArn   string
+	ExistingDbCredentialsKmsKeyArn   string
+	BaseTags                         map[string]string
+	Tags                             map[string]string
+	UseOpenSearchContainer           bool
+	UseOpenSearchServerless          bool
+	EnableOpenSearch                 bool
+	OpenSearchInstanceType           string
+	OpenSearchInstanceCount          int
+	OpenSearchDomainName             string
+	OpenSearchDedicatedMasterCount   int
+	OpenSearchDedicatedMasterType    string
+	OpenSearchEngineVersion          string
+	OpenSearchVolumeType             string
+	OpenSearchVolumeSize             int
+	OpenSearchVolumeIops             int
+	OpenSearchVolumeThroughput       int
+	OpenSearchWarmCount              int
+	OpenSearchWarmType               string
+	OpenSearchEnableColdStorage      bool
+	OpenSearchIamMasterUser          bool
+	OpenSearchEnableSnapshots        bool
+	OpenSearchSnapshotSchedule       string
+	OpenSearchSnapshotRetentionCount int
+	OpenSearchIsmIndexPatterns       []string
+	OpenSearchRolloverDays           int
+	OpenSearchIndexRetentionDays     int
+	OpenSearchContainerImage         string
+	OpenSearchContainerCpu           int
+	OpenSearchContainerMemory        int
+	CreateVpc                        bool
+	EnableNatlessMode                bool
+	VpcEndpoints                     []common.VpcEndpointService
+	DataKmsKeyArn                    string
+	CreateDataKmsKey                 bool
+	VpcCidrBlock                     string
+	VpcAvailabilityZoneCount         int
 }
 
 func NewConfig(ctx *pulumi.Context) (*ConfigValues, error) {
@@ -54,20 +113,215 @@ func NewConfig(ctx *pulumi.Context) (*ConfigValues, error) {
 	awsConfig := config.New(ctx, "aws")
 	configValues.Region = awsConfig.Require("region")
 
+	// providers for other regions and AWS SDK clients authenticate with the same settings as the default provider
+	configValues.AwsSettings, err = common.ReadAwsSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	appConfig := config.New(ctx, "")
+
+	// user defined tags are applied, along with the base tags, to every taggable resource
+	var tags map[string]string
+	err = appConfig.GetObject("tags", &tags)
+	if err != nil {
+		return nil, fmt.Errorf("tags must be a map of tag keys to string values: %w", err)
+	}
+
+	configValues.Tags, err = common.MergeTags(configValues.BaseTags, tags)
+	if err != nil {
+		return nil, err
+	}
+
 	configValues.CommonName = appConfig.Get("commonName")
 	if configValues.CommonName == "" {
 		configValues.CommonName = "pulumiselfhosted"
 	}
 
-	appConfig.RequireObject("publicSubnetIds", &configValues.PublicSubnetIds)
-	appConfig.RequireObject("privateSubnetIds", &configValues.PrivateSubnetIds)
-	appConfig.RequireObject("isolatedSubnetIds", &configValues.IsolatedSubnetIds)
+	// bring your own VPC is the default; if no vpcId is provided we will create the VPC and all subnet tiers
+	configValues.VpcId = appConfig.Get("vpcId")
+	if configValues.VpcId != "" {
+		appConfig.RequireObject("publicSubnetIds", &configValues.PublicSubnetIds)
+		appConfig.RequireObject("privateSubnetIds", &configValues.PrivateSubnetIds)
+		appConfig.RequireObject("isolatedSubnetIds", &configValues.IsolatedSubnetIds)
+	} else {
+		configValues.CreateVpc = true
+
+		appConfig.GetObject("publicSubnetIds", &configValues.PublicSubnetIds)
+		appConfig.GetObject("privateSubnetIds", &configValues.PrivateSubnetIds)
+		appConfig.GetObject("isolatedSubnetIds", &configValues.IsolatedSubnetIds)
+		if len(configValues.PublicSubnetIds) > 0 || len(configValues.PrivateSubnetIds) > 0 || len(configValues.IsolatedSubnetIds) > 0 {
+			return nil, errors.New("subnet ids cannot be provided without a vpcId. Either provide vpcId or remove the subnet ids to create a new VPC")
+		}
+
+		configValues.VpcCidrBlock = appConfig.Get("vpcCidrBlock")
+		if configValues.VpcCidrBlock == "" {
+			configValues.VpcCidrBlock = "10.0.0.0/16"
+		}
+
+		configValues.VpcAvailabilityZoneCount = appConfig.GetInt("vpcAvailabilityZoneCount")
+		if configValues.VpcAvailabilityZoneCount == 0 {
+			configValues.VpcAvailabilityZoneCount = 3
+		}
+	}
+
+	// interface endpoints come from a catalog; entries can be switched on or off and services outside the catalog added
+	var vpcEndpointOverrides map[string]bool
+	var extraVpcEndpoints []string
+	appConfig.GetObject("vpcEndpoints", &vpcEndpointOverrides)
+	appConfig.GetObject("extraVpcEndpoints", &extraVpcEndpoints)
+
+	// natless mode removes the NAT Gateways from a created VPC, so every AWS service the ECS tasks call must have an endpoint
+	configValues.EnableNatlessMode = appConfig.GetBool("enableNatlessMode")
+	if configValues.EnableNatlessMode {
+		vpcEndpointOverrides, err = common.RequireVpcEndpoints(vpcEndpointOverrides, common.NatlessVpcEndpoints)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	configValues.VpcEndpoints, err = common.ResolveVpcEndpoints(common.DefaultVpcEndpoints, vpcEndpointOverrides, extraVpcEndpoints)
+	if err != nil {
+		return nil, err
+	}
 
-	configValues.VpcId = appConfig.Require("vpcId")
 	configValues.NumberDbReplicas = appConfig.GetInt("numberDbReplicas")
-	if configValues.NumberDbReplicas > 2 || configValues.NumberDbReplicas < 0 {
-		return nil, errors.New("db replicas cannot be greater than 2 or less than zero")
+	if configValues.NumberDbReplicas > maxDbReplicas || configValues.NumberDbReplicas < 0 {
+		return nil, fmt.Errorf("db replicas cannot be greater than %d or less than zero", maxDbReplicas)
+	}
+
+	// optional instance class per replica, in replica order; replicas without an entry use dbInstanceType
+	appConfig.GetObject("dbReplicaInstanceTypes", &configValues.DbReplicaInstanceTypes)
+	if len(configValues.DbReplicaInstanceTypes) > configValues.NumberDbReplicas {
+		return nil, errors.New("dbReplicaInstanceTypes cannot have more entries than numberDbReplicas")
+	}
+
+	// Aurora auto scaling adds and removes readers on top of the replicas above based on reader CPU
+	configValues.EnableDbReplicaAutoscaling = appConfig.GetBool("enableDbReplicaAutoscaling")
+	if configValues.EnableDbReplicaAutoscaling {
+		configValues.DbReplicaAutoscalingMin = appConfig.GetInt("dbReplicaAutoscalingMin")
+		if configValues.DbReplicaAutoscalingMin == 0 {
+			configValues.DbReplicaAutoscalingMin = 1
+		}
+
+		configValues.DbReplicaAutoscalingMax = appConfig.GetInt("dbReplicaAutoscalingMax")
+		if configValues.DbReplicaAutoscalingMax == 0 {
+			configValues.DbReplicaAutoscalingMax = 5
+		}
+
+		configValues.DbReplicaAutoscalingTargetCpu = appConfig.GetFloat64("dbReplicaAutoscalingTargetCpu")
+		if configValues.DbReplicaAutoscalingTargetCpu == 0 {
+			configValues.DbReplicaAutoscalingTargetCpu = 70
+		}
+
+		if configValues.DbReplicaAutoscalingMin < 1 || configValues.DbReplicaAutoscalingMin > configValues.DbReplicaAutoscalingMax {
+			return nil, errors.New("db replica autoscaling min must be at least 1 and cannot be greater than max")
+		}
+
+		if configValues.NumberDbReplicas+configValues.DbReplicaAutoscalingMax > maxDbReplicas {
+			return nil, fmt.Errorf("numberDbReplicas plus dbReplicaAutoscalingMax cannot be greater than %d", maxDbReplicas)
+		}
+
+		if configValues.DbReplicaAutoscalingTargetCpu <= 0 || configValues.DbReplicaAutoscalingTargetCpu > 100 {
+			return nil, errors.New("db replica autoscaling target cpu must be between 0 and 100")
+		}
+	}
+
+	// bring your own database; if an endpoint is provided no Aurora cluster will be created
+	configValues.ExistingDbEndpoint = appConfig.Get("existingDbEndpoint")
+	if configValues.ExistingDbEndpoint != "" {
+		configValues.UseExistingDb = true
+		configValues.ExistingDbSecurityGroupId = appConfig.Require("existingDbSecurityGroupId")
+		configValues.ExistingDbCredentialsSecretArn = appConfig.Require("existingDbCredentialsSecretArn")
+
+		configValues.ExistingDbPort = appConfig.GetInt("existingDbPort")
+		if configValues.ExistingDbPort == 0 {
+			configValues.ExistingDbPort = 3306
+		}
+
+		configValues.ExistingDbName = appConfig.Get("existingDbName")
+		if configValues.ExistingDbName == "" {
+			configValues.ExistingDbName = "pulumi"
+		}
+
+		// exported as dbUsername; read from the credentials secret when not set
+		configValues.ExistingDbUsername = appConfig.Get("existingDbUsername")
+	}
+
+	// RDS Proxy sits in front of the Aurora cluster to pool connections from the API service
+	configValues.EnableDbProxy = appConfig.GetBool("enableDbProxy")
+	if configValues.EnableDbProxy && configValues.UseExistingDb {
+		return nil, errors.New("enableDbProxy is not supported with existingDbEndpoint")
+	}
+
+	// restoring only applies when the cluster is first created; eg- DR drills or cloning production into staging
+	configValues.RestoreFromSnapshotIdentifier = appConfig.Get("restoreFromSnapshotIdentifier")
+	if configValues.RestoreFromSnapshotIdentifier != "" && configValues.UseExistingDb {
+		return nil, errors.New("restoreFromSnapshotIdentifier is not supported with existingDbEndpoint")
+	}
+
+	// the parameter groups use the aurora-mysql8.0 family, so only 8.0 compatible versions can be used
+	configValues.DbEngineVersion = appConfig.Get("dbEngineVersion")
+	if configValues.DbEngineVersion == "" {
+		configValues.DbEngineVersion = "8.0.mysql_aurora.3.12.0"
+	}
+
+	_, err = common.CompareAuroraMysqlVersions(configValues.DbEngineVersion, configValues.DbEngineVersion)
+	if err != nil || !strings.HasPrefix(configValues.DbEngineVersion, "8.0.") {
+		return nil, fmt.Errorf("dbEngineVersion %s must be an Aurora MySQL 8.0 engine version, eg- 8.0.mysql_aurora.3.12.0", configValues.DbEngineVersion)
+	}
+
+	// parameter overrides are merged over the installer defaults; only a known set of keys is accepted
+	err = appConfig.GetObject("dbInstanceParameters", &configValues.DbInstanceParameters)
+	if err != nil {
+		return nil, fmt.Errorf("dbInstanceParameters must be a map of parameter names to string values: %w", err)
+	}
+
+	err = common.ValidateDbParameters("dbInstanceParameters", configValues.DbInstanceParameters, common.AuroraInstanceParameters)
+	if err != nil {
+		return nil, err
+	}
+
+	err = appConfig.GetObject("dbClusterParameters", &configValues.DbClusterParameters)
+	if err != nil {
+		return nil, fmt.Errorf("dbClusterParameters must be a map of parameter names to string values: %w", err)
+	}
+
+	err = common.ValidateDbParameters("dbClusterParameters", configValues.DbClusterParameters, common.AuroraClusterParameters)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aurora manages the master password in Secrets Manager; only the rotation schedule is configurable
+	configValues.DbPasswordRotationDays = appConfig.GetInt("dbPasswordRotationDays")
+	if configValues.DbPasswordRotationDays == 0 {
+		configValues.DbPasswordRotationDays = 7
+	}
+
+	if configValues.DbPasswordRotationDays < 1 || configValues.DbPasswordRotationDays > 365 {
+		return nil, errors.New("db password rotation days must be between 1 and 365")
+	}
+
+	// optional Aurora Global Database secondary in a second region for disaster recovery
+	configValues.DbDrRegion = appConfig.Get("dbDrRegion")
+	if configValues.DbDrRegion != "" {
+		if configValues.UseExistingDb {
+			return nil, errors.New("dbDrRegion is not supported with existingDbEndpoint")
+		}
+
+		if configValues.DbDrRegion == configValues.Region {
+			return nil, errors.New("dbDrRegion must be different from the primary aws:region")
+		}
+
+		configValues.DbDrVpcId = appConfig.Require("dbDrVpcId")
+		appConfig.RequireObject("dbDrSubnetIds", &configValues.DbDrSubnetIds)
+		configValues.DbDrKmsKeyArn = appConfig.Get("dbDrKmsKeyArn")
+	}
+
+	// RDS blue/green deployments do not support clusters in a global database
+	configValues.DbBlueGreenUpgrade = appConfig.GetBool("dbBlueGreenUpgrade")
+	if configValues.DbBlueGreenUpgrade && (configValues.UseExistingDb || configValues.DbDrRegion != "") {
+		return nil, errors.New("dbBlueGreenUpgrade is not supported with existingDbEndpoint or dbDrRegion")
 	}
 
 	configValues.DbInstanceType = appConfig.Get("dbInstanceType")
@@ -75,6 +329,35 @@ func NewConfig(ctx *pulumi.Context) (*ConfigValues, error) {
 		configValues.DbInstanceType = "db.t3.medium"
 	}
 
+	// serverless v2 instances scale between min/max Aurora Capacity Units (ACUs) instead of using a fixed instance type
+	configValues.EnableDbServerless = appConfig.GetBool("enableDbServerless")
+	if configValues.EnableDbServerless {
+		configValues.DbServerlessMinCapacity = appConfig.GetFloat64("dbServerlessMinCapacity")
+		if configValues.DbServerlessMinCapacity == 0 {
+			configValues.DbServerlessMinCapacity = 0.5
+		}
+
+		configValues.DbServerlessMaxCapacity = appConfig.GetFloat64("dbServerlessMaxCapacity")
+		if configValues.DbServerlessMaxCapacity == 0 {
+			configValues.DbServerlessMaxCapacity = 4
+		}
+
+		if configValues.DbServerlessMinCapacity < 0.5 || configValues.DbServerlessMaxCapacity > 256 {
+			return nil, errors.New("db serverless capacity must be between 0.5 and 256 ACUs")
+		}
+
+		if configValues.DbServerlessMinCapacity > configValues.DbServerlessMaxCapacity {
+			return nil, errors.New("db serverless min capacity cannot be greater than max capacity")
+		}
+	}
+
+	// customer managed key used to encrypt Aurora, OpenSearch, S3 and CloudWatch Logs; either provided or created
+	configValues.DataKmsKeyArn = appConfig.Get("dataKmsKeyArn")
+	configValues.CreateDataKmsKey = appConfig.GetBool("createDataKmsKey")
+	if configValues.DataKmsKeyArn != "" && configValues.CreateDataKmsKey {
+		return nil, errors.New("dataKmsKeyArn and createDataKmsKey cannot both be set")
+	}
+
 	configValues.EnableOpenSearch = appConfig.GetBool("enableOpenSearch")
 	configValues.OpenSearchInstanceType = appConfig.Get("openSearchInstanceType")
 	if configValues.OpenSearchInstanceType == "" {
@@ -90,5 +373,116 @@ func NewConfig(ctx *pulumi.Context) (*ConfigValues, error) {
 	}
 	configValues.OpenSearchDedicatedMasterCount = appConfig.GetInt("openSearchDedicatedMasterCount")
 
+	// dedicated masters default to the data node type
+	configValues.OpenSearchDedicatedMasterType = appConfig.Get("openSearchDedicatedMasterType")
+	if configValues.OpenSearchDedicatedMasterType == "" && configValues.OpenSearchDedicatedMasterCount > 0 {
+		configValues.OpenSearchDedicatedMasterType = configValues.OpenSearchInstanceType
+	}
+
+	configValues.OpenSearchEngineVersion = appConfig.Get("openSearchEngineVersion")
+	if configValues.OpenSearchEngineVersion == "" {
+		configValues.OpenSearchEngineVersion = "OpenSearch_2.13"
+	}
+
+	// storage defaults match earlier releases so existing domains are not modified; gp3 is recommended for new installs
+	configValues.OpenSearchVolumeType = appConfig.Get("openSearchVolumeType")
+	if configValues.OpenSearchVolumeType == "" {
+		configValues.OpenSearchVolumeType = "gp2"
+	}
+	configValues.OpenSearchVolumeSize = appConfig.GetInt("openSearchVolumeSize")
+	if configValues.OpenSearchVolumeSize == 0 {
+		configValues.OpenSearchVolumeSize = 10
+	}
+	configValues.OpenSearchVolumeIops = appConfig.GetInt("openSearchVolumeIops")
+	configValues.OpenSearchVolumeThroughput = appConfig.GetInt("openSearchVolumeThroughput")
+
+	// UltraWarm and cold storage move older indexes off the EBS volumes
+	configValues.OpenSearchWarmCount = appConfig.GetInt("openSearchWarmCount")
+	configValues.OpenSearchWarmType = appConfig.Get("openSearchWarmType")
+	if configValues.OpenSearchWarmType == "" && configValues.OpenSearchWarmCount > 0 {
+		configValues.OpenSearchWarmType = "ultrawarm1.medium.search"
+	}
+	configValues.OpenSearchEnableColdStorage = appConfig.GetBool("openSearchEnableColdStorage")
+
+	// opt-in: the API role replaces the internal admin user, so the API must sign its search requests
+	configValues.OpenSearchIamMasterUser = appConfig.GetBool("openSearchIamMasterUser")
+	if configValues.OpenSearchIamMasterUser && !configValues.EnableOpenSearch {
+		return nil, errors.New("openSearchIamMasterUser requires enableOpenSearch")
+	}
+
+	// manual snapshots to S3 and index rollover/expiry; the domain's own automated snapshots cannot be restored to another domain
+	configValues.OpenSearchEnableSnapshots = appConfig.GetBool("enableOpenSearchSnapshots")
+	configValues.OpenSearchSnapshotSchedule = appConfig.Get("openSearchSnapshotSchedule")
+	if configValues.OpenSearchSnapshotSchedule == "" {
+		configValues.OpenSearchSnapshotSchedule = "0 3 * * *"
+	}
+	configValues.OpenSearchSnapshotRetentionCount = appConfig.GetInt("openSearchSnapshotRetentionCount")
+	if configValues.OpenSearchSnapshotRetentionCount == 0 {
+		configValues.OpenSearchSnapshotRetentionCount = 14
+	}
+	err = appConfig.GetObject("openSearchIsmIndexPatterns", &configValues.OpenSearchIsmIndexPatterns)
+	if err != nil {
+		return nil, fmt.Errorf("openSearchIsmIndexPatterns must be a list of index patterns: %w", err)
+	}
+	configValues.OpenSearchRolloverDays = appConfig.GetInt("openSearchRolloverDays")
+	if configValues.OpenSearchRolloverDays == 0 {
+		configValues.OpenSearchRolloverDays = 7
+	}
+	configValues.OpenSearchIndexRetentionDays = appConfig.GetInt("openSearchIndexRetentionDays")
+	if configValues.OpenSearchIndexRetentionDays == 0 {
+		configValues.OpenSearchIndexRetentionDays = 90
+	}
+
+	// the setup function maps its role into the domain with the admin user, which the IAM master user mode doesn't have
+	if configValues.OpenSearchEnableSnapshots && configValues.OpenSearchIamMasterUser {
+		return nil, errors.New("enableOpenSearchSnapshots is not supported with openSearchIamMasterUser")
+	}
+
+	// a single OpenSearch node on ECS with EFS storage replaces the managed domain for smaller installs
+	configValues.UseOpenSearchContainer = appConfig.GetBool("useOpenSearchContainer")
+	if configValues.UseOpenSearchContainer {
+		if configValues.EnableOpenSearch {
+			return nil, errors.New("enableOpenSearch and useOpenSearchContainer cannot both be set")
+		}
+
+		configValues.OpenSearchContainerImage = appConfig.Get("openSearchContainerImage")
+		if configValues.OpenSearchContainerImage == "" {
+			configValues.OpenSearchContainerImage = "public.ecr.aws/opensearchproject/opensearch:2.19.1"
+		}
+
+		configValues.OpenSearchContainerCpu = appConfig.GetInt("openSearchContainerCpu")
+		if configValues.OpenSearchContainerCpu == 0 {
+			configValues.OpenSearchContainerCpu = 1024
+		}
+
+		configValues.OpenSearchContainerMemory = appConfig.GetInt("openSearchContainerMemory")
+		if configValues.OpenSearchContainerMemory == 0 {
+			configValues.OpenSearchContainerMemory = 4096
+		}
+
+		if configValues.OpenSearchContainerMemory < 2048 {
+			return nil, errors.New("openSearchContainerMemory must be at least 2048 MB")
+		}
+	}
+
+	// an OpenSearch Serverless collection, reached through its own VPC endpoint, replaces the managed domain without sizing nodes
+	configValues.UseOpenSearchServerless = appConfig.GetBool("useOpenSearchServerless")
+	if configValues.UseOpenSearchServerless {
+		if configValues.EnableOpenSearch || configValues.UseOpenSearchContainer {
+			return nil, errors.New("useOpenSearchServerless cannot be set with enableOpenSearch or useOpenSearchContainer")
+		}
+
+		err = common.ValidateOpenSearchCollectionName(configValues.OpenSearchDomainName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// referenced resources are checked up front so misconfiguration fails before anything is created
+	err = runPreflight(ctx, &configValues)
+	if err != nil {
+		return nil, err
+	}
+
 	return &configValues, nil
 }
@@ -3,15 +3,21 @@ package main
 import (
 	"errors"
 	"fmt"
+	"sort"
 
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/appautoscaling"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/rds"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/secretsmanager"
 	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
 	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+// Aurora supports up to 15 readers in a cluster
+const maxDbReplicas = 15
+
 func NewDatabase(ctx *pulumi.Context, name string, args *DatabaseArgs, opts ...pulumi.ResourceOption) (*Database, error) {
 	var resource Database
 
@@ -40,77 +46,108 @@ func NewDatabase(ctx *pulumi.Context, name string, args *DatabaseArgs, opts ...p
 		return nil, err
 	}
 
-	dbPassword, err := random.NewRandomPassword(ctx, ToCommonName(name, "db-password"), &random.RandomPasswordArgs{
-		Length:          pulumi.Int(16),
-		OverrideSpecial: pulumi.String("_"),
-		Special:         pulumi.BoolPtr(true),
+	finalSnapshotId, err := random.NewRandomId(ctx, ToCommonName(name, "snapshot-id"), &random.RandomIdArgs{
+		Prefix:     pulumi.String("snapshot-"),
+		ByteLength: pulumi.Int(16),
 	}, options...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	finalSnapshotId, err := random.NewRandomId(ctx, ToCommonName(name, "snapshot-id"), &random.RandomIdArgs{
-		Prefix:     pulumi.String("snapshot-"),
-		ByteLength: pulumi.Int(16),
+	engine := "aurora-mysql"
+	engineVersion := args.engineVersion
+
+	// blue/green deployments replicate to the green cluster from the binlog
+	clusterParameterDefaults := map[string]string{}
+	if args.blueGreenUpgrade {
+		clusterParameterDefaults["binlog_format"] = "ROW"
+	}
+
+	// cluster wide settings, eg- binlog_format or innodb_*; empty unless the user provides overrides
+	clusterParameterGroup, err := rds.NewClusterParameterGroup(ctx, ToCommonName(name, "cluster-options"), &rds.ClusterParameterGroupArgs{
+		Family:     pulumi.String("aurora-mysql8.0"),
+		Parameters: newClusterParameters(common.MergeDbParameters(clusterParameterDefaults, args.clusterParameters)),
 	}, options...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	engine := "aurora-mysql"
-	engineVersion := "8.0.mysql_aurora.3.12.0"
+	clusterArgs := &rds.ClusterArgs{
+		ApplyImmediately:            pulumi.BoolPtr(true),
+		BackupRetentionPeriod:       pulumi.Int(7), // days
+		CopyTagsToSnapshot:          pulumi.BoolPtr(true),
+		DbSubnetGroupName:           subnetGroup.ID(), // misleading ... its ID not name
+		DbClusterParameterGroupName: clusterParameterGroup.Name,
+		DeletionProtection:          pulumi.BoolPtr(false),
+		Engine:                      pulumi.String(engine),
+		EngineVersion:               pulumi.String(engineVersion),
+		FinalSnapshotIdentifier:     finalSnapshotId.Hex,
+		StorageEncrypted:            pulumi.BoolPtr(true),
+		KmsKeyId:                    args.kmsKeyArn,
+		VpcSecurityGroupIds:         pulumi.StringArray{securityGroup.ID()},
+		// Aurora generates the master password and stores it in a Secrets Manager secret that it owns and rotates
+		ManageMasterUserPassword: pulumi.BoolPtr(true),
+		MasterUserSecretKmsKeyId: args.kmsKeyArn,
+	}
+
+	// serverless v2 instances still use the provisioned engine mode; the cluster only needs a scaling range
+	instanceClass := args.instanceType
+	if args.serverless {
+		clusterArgs.Serverlessv2ScalingConfiguration = &rds.ClusterServerlessv2ScalingConfigurationArgs{
+			MinCapacity: pulumi.Float64(args.serverlessMinCapacity),
+			MaxCapacity: pulumi.Float64(args.serverlessMaxCapacity),
+		}
+		instanceClass = pulumi.String("db.serverless")
+	}
 
 	clusterOpts := append(options, pulumi.Protect(true))
-	cluster, err := rds.NewCluster(ctx, ToCommonName(name, "aurora-cluster"), &rds.ClusterArgs{
-		ApplyImmediately:        pulumi.BoolPtr(true),
-		BackupRetentionPeriod:   pulumi.Int(7), // days
-		CopyTagsToSnapshot:      pulumi.BoolPtr(true),
-		DatabaseName:            pulumi.String("pulumi"),
-		DbSubnetGroupName:       subnetGroup.ID(), // misleading ... its ID not name
-		DeletionProtection:      pulumi.BoolPtr(false),
-		Engine:                  pulumi.String(engine),
-		EngineVersion:           pulumi.String(engineVersion),
-		FinalSnapshotIdentifier: finalSnapshotId.Hex,
-		MasterUsername:          pulumi.String("pulumi"),
-		MasterPassword:          dbPassword.Result,
-		StorageEncrypted:        pulumi.BoolPtr(true),
-		VpcSecurityGroupIds:     pulumi.StringArray{securityGroup.ID()},
-	}, clusterOpts...)
+
+	// the database name and master username come from the snapshot when restoring, so the cluster only sets them on a fresh install.
+	// the managed master password is reset after the restore, so the credentials secret always matches the restored cluster.
+	// none of these can change after creation; ignoring them keeps a later config change from replacing the cluster.
+	ignoreChanges := []string{"snapshotIdentifier", "databaseName", "masterUsername"}
+	if args.snapshotIdentifier != "" {
+		err = checkSnapshot(ctx, args.snapshotIdentifier, engine, engineVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		clusterArgs.SnapshotIdentifier = pulumi.String(args.snapshotIdentifier)
+	} else {
+		clusterArgs.DatabaseName = pulumi.String("pulumi")
+		clusterArgs.MasterUsername = pulumi.String("pulumi")
+	}
+
+	// once the cluster joins a global database its global cluster identifier is managed by the global cluster
+	if args.drRegion != "" {
+		ignoreChanges = append(ignoreChanges, "globalClusterIdentifier")
+	}
+
+	// version changes are applied out-of-band by a blue/green deployment rather than an in-place modification
+	instanceOpts := clusterOpts
+	if args.blueGreenUpgrade {
+		ignoreChanges = append(ignoreChanges, "engineVersion")
+		instanceOpts = append(instanceOpts, pulumi.IgnoreChanges([]string{"engineVersion"}))
+	}
+
+	primaryOpts := append(clusterOpts, pulumi.IgnoreChanges(ignoreChanges))
+
+	cluster, err := rds.NewCluster(ctx, ToCommonName(name, "aurora-cluster"), clusterArgs, primaryOpts...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	// Enable the general and slow query logs and write them to files on the RDS instance.
-	parameterGroup, err := rds.NewParameterGroup(ctx, ToCommonName(name, "instance-options"), &rds.ParameterGroupArgs{
-		Family: pulumi.String("aurora-mysql8.0"),
-		Parameters: rds.ParameterGroupParameterArray{
-			&rds.ParameterGroupParameterArgs{
-				Name:  pulumi.String("slow_query_log"),
-				Value: pulumi.String("1"),
-			},
-			&rds.ParameterGroupParameterArgs{
-				Name:  pulumi.String("long_query_time"),
-				Value: pulumi.String("4.9"),
-			},
-			&rds.ParameterGroupParameterArgs{
-				Name:  pulumi.String("log_queries_not_using_indexes"),
-				Value: pulumi.String("1"),
-			},
-			&rds.ParameterGroupParameterArgs{
-				Name:  pulumi.String("general_log"),
-				Value: pulumi.String("1"),
-			},
-			&rds.ParameterGroupParameterArgs{
-				Name:  pulumi.String("log_output"),
-				Value: pulumi.String("FILE"),
-			},
-			&rds.ParameterGroupParameterArgs{
-				Name:  pulumi.String("sql_mode"),
-				Value: pulumi.String("ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION"),
-			},
+	// the secret holds JSON username and password keys; consumers read it directly rather than copying the password around
+	credentialsSecretArn := cluster.MasterUserSecrets.Index(pulumi.Int(0)).SecretArn().Elem()
+
+	// rotation is on by default for managed secrets; this only sets the schedule
+	_, err = secretsmanager.NewSecretRotation(ctx, ToCommonName(name, "credentials-rotation"), &secretsmanager.SecretRotationArgs{
+		SecretId: credentialsSecretArn,
+		RotationRules: &secretsmanager.SecretRotationRotationRulesArgs{
+			AutomaticallyAfterDays: pulumi.Int(args.passwordRotationDays),
 		},
 	}, options...)
 
@@ -118,6 +155,26 @@ func NewDatabase(ctx *pulumi.Context, name string, args *DatabaseArgs, opts ...p
 		return nil, err
 	}
 
+	// By default, enable the general and slow query logs and write them to files on the RDS instance.
+	// User provided dbInstanceParameters are merged over these defaults; eg- general_log=0 for production.
+	instanceParameters := common.MergeDbParameters(map[string]string{
+		"slow_query_log":                "1",
+		"long_query_time":               "4.9",
+		"log_queries_not_using_indexes": "1",
+		"general_log":                   "1",
+		"log_output":                    "FILE",
+		"sql_mode":                      "ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION",
+	}, args.instanceParameters)
+
+	parameterGroup, err := rds.NewParameterGroup(ctx, ToCommonName(name, "instance-options"), &rds.ParameterGroupArgs{
+		Family:     pulumi.String("aurora-mysql8.0"),
+		Parameters: newInstanceParameters(instanceParameters),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
 	// govcloud policy arns are different from non-govcloud
 	monitoringArn := common.GetIamPolicyArn(args.region, "arn:aws:iam::aws:policy/service-role/AmazonRDSEnhancedMonitoringRole")
 
@@ -158,10 +215,10 @@ func NewDatabase(ctx *pulumi.Context, name string, args *DatabaseArgs, opts ...p
 	// See: https://docs.aws.amazon.com/AmazonRDS/latest/AuroraUserGuide/Aurora.Replication.html
 	// for more information on how Auora handles failover and read replicas.
 
-	// max is 3 instances (1 master, 2 replica)
+	// Aurora allows up to 15 replicas, including any added by auto scaling
 
-	if args.numberDbReplicas > 2 {
-		return nil, errors.New("number db replicas cannot be greater than 2")
+	if args.numberDbReplicas > maxDbReplicas {
+		return nil, fmt.Errorf("number db replicas cannot be greater than %d", maxDbReplicas)
 	}
 
 	if args.numberDbReplicas < 0 {
@@ -170,49 +227,368 @@ func NewDatabase(ctx *pulumi.Context, name string, args *DatabaseArgs, opts ...p
 
 	// the '1' accounts for our master instance
 	numberInstances := args.numberDbReplicas + 1
+	var instances []pulumi.Resource
 	for i := 0; i < numberInstances; i++ {
+		// replicas may be sized differently from the writer, eg- larger readers for reporting queries
+		replicaInstanceClass := instanceClass
+		if i > 0 && i <= len(args.replicaInstanceTypes) {
+			replicaInstanceClass = pulumi.String(args.replicaInstanceTypes[i-1])
+		}
+
 		instanceId := fmt.Sprintf("instance-%d", i)
-		_, err := rds.NewClusterInstance(ctx, ToCommonName(name, instanceId), &rds.ClusterInstanceArgs{
+		instance, err := rds.NewClusterInstance(ctx, ToCommonName(name, instanceId), &rds.ClusterInstanceArgs{
 			ClusterIdentifier:    cluster.ID(),
 			Engine:               rds.EngineType(engine).ToEngineTypeOutput(),
 			EngineVersion:        pulumi.String(engineVersion),
-			InstanceClass:        args.instanceType,
+			InstanceClass:        replicaInstanceClass,
 			DbParameterGroupName: parameterGroup.Name,
 			MonitoringInterval:   pulumi.Int(5),
 			MonitoringRoleArn:    monitoringRole.Arn,
-		}, clusterOpts...)
+		}, instanceOpts...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, instance)
+	}
 
+	if args.replicaAutoscaling {
+		autoscalingOptions := append(options, pulumi.DependsOn(instances))
+		err = newReplicaAutoscaling(ctx, name, args, cluster, autoscalingOptions...)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	resource.dbActiveEnvironment = pulumi.String(blueEnvironment).ToStringOutput()
+	if args.blueGreenUpgrade {
+		resource.dbActiveEnvironment = newBlueGreenStatus(ctx, args, cluster.ClusterIdentifier)
+	}
+
 	// output specific values to prevent any leaky abstractions
 	resource.dbClusterEndpoint = cluster.Endpoint
+	resource.dbProxyEndpoint = pulumi.String("").ToStringOutput()
+
+	resource.dbDrReaderEndpoint = pulumi.String("").ToStringOutput()
+
+	if args.drRegion != "" {
+		drOptions := append(options, pulumi.DependsOn(instances))
+		resource.dbDrReaderEndpoint, err = newDatabaseDrReplica(ctx, name, args, cluster, instanceClass, drOptions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if args.enableProxy {
+		proxyOptions := append(options, pulumi.DependsOn(instances))
+		resource.dbProxyEndpoint, err = newDatabaseProxy(ctx, name, args, cluster, securityGroup, credentialsSecretArn, proxyOptions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	resource.dbName = cluster.DatabaseName
 	resource.dbUsername = cluster.MasterUsername
-	resource.dbPassword = dbPassword.Result
+	resource.dbCredentialsSecretArn = credentialsSecretArn
+	// the managed secret is encrypted with the data key, which the application stack already grants
+	resource.dbCredentialsKmsKeyArn = pulumi.String("").ToStringOutput()
 	resource.dbSecurityGroupId = securityGroup.ID()
 	resource.dbPort = cluster.Port
 
 	return &resource, nil
 }
 
+// Aurora auto scaling manages readers outside of pulumi. They are created with the writer's instance class and parameter group
+// and are named application-autoscaling-*. The scalable target needs an available writer, so it is created after the instances.
+func newReplicaAutoscaling(ctx *pulumi.Context, name string, args *DatabaseArgs, cluster *rds.Cluster, options ...pulumi.ResourceOption) error {
+	target, err := appautoscaling.NewTarget(ctx, ToCommonName(name, "replica-scaling-target"), &appautoscaling.TargetArgs{
+		ServiceNamespace:  pulumi.String("rds"),
+		ScalableDimension: pulumi.String("rds:cluster:ReadReplicaCount"),
+		ResourceId:        pulumi.Sprintf("cluster:%s", cluster.ClusterIdentifier),
+		MinCapacity:       pulumi.Int(args.replicaAutoscalingMin),
+		MaxCapacity:       pulumi.Int(args.replicaAutoscalingMax),
+	}, options...)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = appautoscaling.NewPolicy(ctx, ToCommonName(name, "replica-scaling-policy"), &appautoscaling.PolicyArgs{
+		PolicyType:        pulumi.String("TargetTrackingScaling"),
+		ResourceId:        target.ResourceId,
+		ScalableDimension: target.ScalableDimension,
+		ServiceNamespace:  target.ServiceNamespace,
+		TargetTrackingScalingPolicyConfiguration: appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationArgs{
+			PredefinedMetricSpecification: appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationPredefinedMetricSpecificationArgs{
+				PredefinedMetricType: pulumi.String("RDSReaderAverageCPUUtilization"),
+			},
+			TargetValue: pulumi.Float64(args.replicaAutoscalingCpu),
+			// new readers take several minutes to become available; avoid adding more while they start
+			ScaleInCooldown:  pulumi.Int(300),
+			ScaleOutCooldown: pulumi.Int(300),
+		},
+	}, options...)
+
+	return err
+}
+
+// static parameters can only be applied on reboot; RDS rejects them with an immediate apply method
+func parameterApplyMethod(static bool) pulumi.String {
+	if static {
+		return pulumi.String("pending-reboot")
+	}
+
+	return pulumi.String("immediate")
+}
+
+// parameters are sorted by name so the order is stable between updates
+func sortedParameterNames(parameters map[string]string) []string {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func newInstanceParameters(parameters map[string]string) rds.ParameterGroupParameterArray {
+	var result rds.ParameterGroupParameterArray
+	for _, name := range sortedParameterNames(parameters) {
+		result = append(result, &rds.ParameterGroupParameterArgs{
+			Name:        pulumi.String(name),
+			Value:       pulumi.String(parameters[name]),
+			ApplyMethod: parameterApplyMethod(common.AuroraInstanceParameters[name]),
+		})
+	}
+
+	return result
+}
+
+func newClusterParameters(parameters map[string]string) rds.ClusterParameterGroupParameterArray {
+	var result rds.ClusterParameterGroupParameterArray
+	for _, name := range sortedParameterNames(parameters) {
+		result = append(result, &rds.ClusterParameterGroupParameterArgs{
+			Name:        pulumi.String(name),
+			Value:       pulumi.String(parameters[name]),
+			ApplyMethod: parameterApplyMethod(common.AuroraClusterParameters[name]),
+		})
+	}
+
+	return result
+}
+
+// make sure the snapshot can be restored into the pinned engine version and tell the user what to expect when the versions differ
+func checkSnapshot(ctx *pulumi.Context, snapshotIdentifier string, engine string, engineVersion string) error {
+	snapshot, err := rds.LookupClusterSnapshot(ctx, &rds.LookupClusterSnapshotArgs{
+		DbClusterSnapshotIdentifier: pulumi.StringRef(snapshotIdentifier),
+		IncludeShared:               pulumi.BoolRef(true),
+	}, nil)
+
+	if err != nil {
+		return fmt.Errorf("unable to find cluster snapshot %s: %w", snapshotIdentifier, err)
+	}
+
+	if snapshot.Engine != engine {
+		return fmt.Errorf("cluster snapshot %s is a %s snapshot; only %s snapshots can be restored", snapshotIdentifier, snapshot.Engine, engine)
+	}
+
+	comparison, err := common.CompareAuroraMysqlVersions(snapshot.EngineVersion, engineVersion)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case comparison > 0:
+		return fmt.Errorf("cluster snapshot %s was taken with engine version %s, which is newer than dbEngineVersion (%s). "+
+			"Aurora cannot restore a snapshot into an older engine version. Restore the snapshot with the AWS console or CLI and use existingDbEndpoint instead",
+			snapshotIdentifier, snapshot.EngineVersion, engineVersion)
+	case comparison < 0:
+		ctx.Log.Warn(fmt.Sprintf("cluster snapshot %s was taken with engine version %s; Aurora will upgrade it to %s while restoring. "+
+			"The restore will take longer than usual and the upgrade cannot be undone. Review the Aurora MySQL release notes for %s before continuing.",
+			snapshotIdentifier, snapshot.EngineVersion, engineVersion, engineVersion), nil)
+	}
+
+	return nil
+}
+
+// RDS Proxy pools and multiplexes connections from the API tasks so autoscaling events don't exhaust Aurora connections.
+// the proxy reads the managed master credentials secret using its own IAM role, so it picks up rotated passwords, and lives behind its own security group.
+func newDatabaseProxy(ctx *pulumi.Context, name string, args *DatabaseArgs, cluster *rds.Cluster, dbSecurityGroup *ec2.SecurityGroup, credentialsSecretArn pulumi.StringOutput, options ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
+	proxyRole, err := iam.NewRole(ctx, ToCommonName(name, "proxy-role"), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Sid": "",
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "rds.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}]
+		}`),
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	_, err = iam.NewRolePolicy(ctx, ToCommonName(name, "proxy-secret-pol"), &iam.RolePolicyArgs{
+		Role: proxyRole.ID(),
+		Policy: credentialsSecretArn.ApplyT(func(arn string) string {
+			return fmt.Sprintf(`{
+				"Version": "2012-10-17",
+				"Statement": [{
+					"Effect": "Allow",
+					"Action": "secretsmanager:GetSecretValue",
+					"Resource": "%s"
+				},
+				{
+					"Effect": "Allow",
+					"Action": "kms:Decrypt",
+					"Resource": "*",
+					"Condition": {
+						"StringEquals": {
+							"kms:ViaService": "secretsmanager.%s.amazonaws.com"
+						}
+					}
+				}]
+			}`, arn, args.region)
+		}).(pulumi.StringOutput),
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// API tasks are already allowed egress to the VPC CIDR on the DB port
+	proxySecurityGroup, err := ec2.NewSecurityGroup(ctx, ToCommonName(name, "proxy-sg"), &ec2.SecurityGroupArgs{
+		VpcId: args.vpcId,
+		Ingress: ec2.SecurityGroupIngressArray{
+			&ec2.SecurityGroupIngressArgs{
+				Protocol:    pulumi.String("tcp"),
+				FromPort:    pulumi.Int(3306),
+				ToPort:      pulumi.Int(3306),
+				CidrBlocks:  pulumi.StringArray{pulumi.String(args.vpcCidrBlock)},
+				Description: pulumi.String("Allow VPC CIDR to connect to RDS Proxy"),
+			},
+		},
+		Egress: ec2.SecurityGroupEgressArray{
+			&ec2.SecurityGroupEgressArgs{
+				Protocol:       pulumi.String("tcp"),
+				FromPort:       pulumi.Int(3306),
+				ToPort:         pulumi.Int(3306),
+				SecurityGroups: pulumi.StringArray{dbSecurityGroup.ID()},
+				Description:    pulumi.String("Allow RDS Proxy to connect to Aurora"),
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	_, err = ec2.NewSecurityGroupRule(ctx, ToCommonName(name, "proxy-to-db-rule"), &ec2.SecurityGroupRuleArgs{
+		Type:                  pulumi.String("ingress"),
+		SecurityGroupId:       dbSecurityGroup.ID(),
+		SourceSecurityGroupId: proxySecurityGroup.ID(),
+		FromPort:              pulumi.Int(3306),
+		ToPort:                pulumi.Int(3306),
+		Protocol:              pulumi.String("tcp"),
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// the Pulumi service authenticates with username and password; the proxy exchanges those for the secret's credentials
+	proxy, err := rds.NewProxy(ctx, ToCommonName(name, "proxy"), &rds.ProxyArgs{
+		EngineFamily:        pulumi.String("MYSQL"),
+		RoleArn:             proxyRole.Arn,
+		VpcSubnetIds:        args.isolatedSubnetIds,
+		VpcSecurityGroupIds: pulumi.StringArray{proxySecurityGroup.ID()},
+		IdleClientTimeout:   pulumi.Int(1800),
+		Auths: rds.ProxyAuthArray{
+			&rds.ProxyAuthArgs{
+				AuthScheme: pulumi.String("SECRETS"),
+				IamAuth:    pulumi.String("DISABLED"),
+				SecretArn:  credentialsSecretArn,
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	targetGroup, err := rds.NewProxyDefaultTargetGroup(ctx, ToCommonName(name, "proxy-tg"), &rds.ProxyDefaultTargetGroupArgs{
+		DbProxyName: proxy.Name,
+		ConnectionPoolConfig: &rds.ProxyDefaultTargetGroupConnectionPoolConfigArgs{
+			MaxConnectionsPercent:     pulumi.Int(90),
+			MaxIdleConnectionsPercent: pulumi.Int(50),
+			ConnectionBorrowTimeout:   pulumi.Int(120),
+		},
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	_, err = rds.NewProxyTarget(ctx, ToCommonName(name, "proxy-target"), &rds.ProxyTargetArgs{
+		DbProxyName:         proxy.Name,
+		TargetGroupName:     targetGroup.Name,
+		DbClusterIdentifier: cluster.ClusterIdentifier,
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	return proxy.Endpoint, nil
+}
+
 type Database struct {
 	pulumi.ResourceState
 
-	dbClusterEndpoint pulumi.StringOutput
-	dbName            pulumi.StringOutput
-	dbUsername        pulumi.StringOutput
-	dbPassword        pulumi.StringOutput
-	dbSecurityGroupId pulumi.IDOutput
-	dbPort            pulumi.IntOutput
+	dbClusterEndpoint      pulumi.StringOutput
+	dbProxyEndpoint        pulumi.StringOutput
+	dbDrReaderEndpoint     pulumi.StringOutput
+	dbName                 pulumi.StringOutput
+	dbUsername             pulumi.StringOutput
+	dbActiveEnvironment    pulumi.StringOutput
+	dbCredentialsSecretArn pulumi.StringOutput
+	dbCredentialsKmsKeyArn pulumi.StringOutput
+	dbSecurityGroupId      pulumi.IDOutput
+	dbPort                 pulumi.IntOutput
 }
 
 type DatabaseArgs struct {
-	vpcId             pulumi.String
-	isolatedSubnetIds pulumi.StringArrayInput
-	numberDbReplicas  int
-	instanceType      pulumi.String
-	region            string
+	vpcId                 pulumi.StringOutput
+	isolatedSubnetIds     pulumi.StringArrayInput
+	numberDbReplicas      int
+	replicaInstanceTypes  []string
+	replicaAutoscaling    bool
+	replicaAutoscalingMin int
+	replicaAutoscalingMax int
+	replicaAutoscalingCpu float64
+	instanceType          pulumi.String
+	region                string
+	awsSettings           *common.AwsSettings
+	engineVersion         string
+	blueGreenUpgrade      bool
+	serverless            bool
+	serverlessMinCapacity float64
+	serverlessMaxCapacity float64
+	enableProxy           bool
+	passwordRotationDays  int
+	snapshotIdentifier    string
+	instanceParameters    map[string]string
+	clusterParameters     map[string]string
+	vpcCidrBlock          string
+	drRegion              string
+	drVpcId               string
+	drSubnetIds           []string
+	drKmsKeyArn           string
+	kmsKeyArn             pulumi.StringPtrInput
 }
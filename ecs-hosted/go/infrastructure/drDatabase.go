@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/rds"
+	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+/*
+Create an Aurora Global Database with the primary cluster as its source and a read-only secondary cluster in the DR region.
+Aurora replicates storage to the secondary with typically sub-second lag. In a regional outage the secondary is promoted;
+see the Disaster Recovery section of the README for the promotion steps.
+*/
+func newDatabaseDrReplica(ctx *pulumi.Context, name string, args *DatabaseArgs, primary *rds.Cluster, instanceClass pulumi.StringInput, options ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
+	// global cluster identifiers are account wide; random suffix keeps multiple installs from colliding
+	globalId, err := random.NewRandomId(ctx, ToCommonName(name, "global-id"), &random.RandomIdArgs{
+		Prefix:     pulumi.String("pulumi-global-"),
+		ByteLength: pulumi.Int(4),
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	globalCluster, err := rds.NewGlobalCluster(ctx, ToCommonName(name, "global-cluster"), &rds.GlobalClusterArgs{
+		GlobalClusterIdentifier:   globalId.Hex,
+		SourceDbClusterIdentifier: primary.Arn,
+		ForceDestroy:              pulumi.Bool(true),
+	}, options...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	// the DR provider authenticates with the same aws: settings as the primary region
+	provider, err := aws.NewProvider(ctx, ToCommonName(name, "dr-provider"), common.NewRegionalProviderArgs(args.awsSettings, args.drRegion), options...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	drOptions := append(options, pulumi.Provider(provider))
+
+	// as with the primary, no ingress is allowed by default; a DR application stack will need to create ingress for this sg
+	securityGroup, err := ec2.NewSecurityGroup(ctx, ToCommonName(name, "dr-db-sg"), &ec2.SecurityGroupArgs{
+		VpcId: pulumi.String(args.drVpcId),
+	}, drOptions...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	subnetGroup, err := rds.NewSubnetGroup(ctx, ToCommonName(name, "dr-subnet-group"), &rds.SubnetGroupArgs{
+		SubnetIds: pulumi.ToStringArray(args.drSubnetIds),
+	}, drOptions...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	secondaryArgs := &rds.ClusterArgs{
+		CopyTagsToSnapshot:      pulumi.BoolPtr(true),
+		DbSubnetGroupName:       subnetGroup.ID(),
+		DeletionProtection:      pulumi.BoolPtr(false),
+		Engine:                  globalCluster.Engine,
+		EngineVersion:           globalCluster.EngineVersion,
+		GlobalClusterIdentifier: globalCluster.ID(),
+		SkipFinalSnapshot:       pulumi.BoolPtr(true),
+		StorageEncrypted:        pulumi.BoolPtr(true),
+		VpcSecurityGroupIds:     pulumi.StringArray{securityGroup.ID()},
+	}
+
+	// a serverless primary passes db.serverless as the instance class, which needs the same scaling range on the secondary
+	if args.serverless {
+		secondaryArgs.Serverlessv2ScalingConfiguration = &rds.ClusterServerlessv2ScalingConfigurationArgs{
+			MinCapacity: pulumi.Float64(args.serverlessMinCapacity),
+			MaxCapacity: pulumi.Float64(args.serverlessMaxCapacity),
+		}
+	}
+
+	// encrypted secondaries use the DR region's aws/rds key unless a key is provided
+	if args.drKmsKeyArn != "" {
+		secondaryArgs.KmsKeyId = pulumi.String(args.drKmsKeyArn)
+	}
+
+	// replication source is managed by the global cluster and will drift after a switchover
+	secondaryOpts := append(drOptions, pulumi.Protect(true), pulumi.IgnoreChanges([]string{"replicationSourceIdentifier"}))
+	secondary, err := rds.NewCluster(ctx, ToCommonName(name, "dr-aurora-cluster"), secondaryArgs, secondaryOpts...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	_, err = rds.NewClusterInstance(ctx, ToCommonName(name, "dr-instance-0"), &rds.ClusterInstanceArgs{
+		ClusterIdentifier: secondary.ID(),
+		Engine:            secondary.Engine,
+		EngineVersion:     secondary.EngineVersion,
+		InstanceClass:     instanceClass,
+	}, append(drOptions, pulumi.Protect(true))...)
+
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	ctx.Log.Info(fmt.Sprintf("Aurora global database secondary will be created in %s", args.drRegion), nil)
+
+	return secondary.ReaderEndpoint, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+/*
+Create an interface VPC endpoint, with private DNS, for each resolved catalog entry.
+Endpoints are placed in the private subnets behind the shared endpoint security group.
+Returns the endpoint IDs keyed by service, eg- ecr.api
+*/
+func NewVpcEndpoints(ctx *pulumi.Context, name string, args *VpcEndpointsArgs) (pulumi.StringMap, error) {
+	endpointIds := pulumi.StringMap{}
+
+	for _, e := range args.Services {
+		serviceName := common.GetEnpointAddress(args.Region, fmt.Sprintf("com.amazonaws.%s.%s", args.Region, e.Service))
+		endpoint, err := ec2.NewVpcEndpoint(ctx, ToCommonName(name, e.ResourceName), &ec2.VpcEndpointArgs{
+			VpcId:             args.VpcId,
+			ServiceName:       pulumi.String(serviceName),
+			VpcEndpointType:   pulumi.String("Interface"),
+			PrivateDnsEnabled: pulumi.BoolPtr(true),
+			SecurityGroupIds:  pulumi.StringArray{args.SecurityGroupId},
+			SubnetIds:         args.SubnetIds,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		endpointIds[e.Service] = endpoint.ID()
+	}
+
+	return endpointIds, nil
+}
+
+/*
+Find the route tables of the user provided private subnets so the S3 gateway endpoint can be associated with them.
+Subnets without an explicit association use the VPC's main route table.
+A default route means the subnet still has a path to the internet, which natless mode does not need; this is only a warning.
+*/
+func lookupPrivateRouteTables(ctx *pulumi.Context, vpcId string, subnetIds []string) (pulumi.StringArray, error) {
+	var routeTableIds pulumi.StringArray
+	seen := map[string]bool{}
+
+	for _, subnetId := range subnetIds {
+		routeTable, err := ec2.LookupRouteTable(ctx, &ec2.LookupRouteTableArgs{
+			SubnetId: pulumi.StringRef(subnetId),
+		})
+
+		if err != nil {
+			routeTable, err = ec2.LookupRouteTable(ctx, &ec2.LookupRouteTableArgs{
+				VpcId: pulumi.StringRef(vpcId),
+				Filters: []ec2.GetRouteTableFilter{
+					{
+						Name:   "association.main",
+						Values: []string{"true"},
+					},
+				},
+			})
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to find the route table of private subnet %s: %w", subnetId, err)
+		}
+
+		for _, route := range routeTable.Routes {
+			if route.CidrBlock == "0.0.0.0/0" {
+				ctx.Log.Warn(fmt.Sprintf("private subnet %s has a default route in %s; natless mode does not use it", subnetId, routeTable.RouteTableId), nil)
+			}
+		}
+
+		if !seen[routeTable.RouteTableId] {
+			seen[routeTable.RouteTableId] = true
+			routeTableIds = append(routeTableIds, pulumi.String(routeTable.RouteTableId))
+		}
+	}
+
+	return routeTableIds, nil
+}
+
+type VpcEndpointsArgs struct {
+	Region          string
+	Services        []common.VpcEndpointService
+	VpcId           pulumi.StringOutput
+	SubnetIds       pulumi.StringArrayOutput
+	SecurityGroupId pulumi.IDOutput
+}
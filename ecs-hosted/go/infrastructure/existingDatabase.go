@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+/*
+Bring your own database. No resources are created; instead the user provided endpoint, port and security group
+along with the ARN of the credentials secret in Secrets Manager are surfaced with the same shape as NewDatabase so the
+application stack does not need to know the difference.
+The secret is expected to use the standard RDS JSON format, eg- {"username": "...", "password": "..."}
+*/
+func NewExistingDatabase(ctx *pulumi.Context, args *ExistingDatabaseArgs) (*Database, error) {
+	var resource Database
+
+	resource.dbClusterEndpoint = pulumi.String(args.Endpoint).ToStringOutput()
+	resource.dbProxyEndpoint = pulumi.String("").ToStringOutput()
+	resource.dbDrReaderEndpoint = pulumi.String("").ToStringOutput()
+	resource.dbName = pulumi.String(args.Name).ToStringOutput()
+	resource.dbUsername = existingDbUsername(ctx, args)
+	resource.dbActiveEnvironment = pulumi.String("").ToStringOutput()
+	resource.dbCredentialsSecretArn = pulumi.String(args.CredentialsSecretArn).ToStringOutput()
+	resource.dbCredentialsKmsKeyArn = pulumi.String(args.CredentialsKmsKeyArn).ToStringOutput()
+	resource.dbSecurityGroupId = pulumi.ID(args.SecurityGroupId).ToIDOutput()
+	resource.dbPort = pulumi.Int(args.Port).ToIntOutput()
+
+	return &resource, nil
+}
+
+// the configured username, or the one in the credentials secret; only the username is taken from the secret and it is not a secret itself
+func existingDbUsername(ctx *pulumi.Context, args *ExistingDatabaseArgs) pulumi.StringOutput {
+	if args.Username != "" {
+		return pulumi.String(args.Username).ToStringOutput()
+	}
+
+	secret := secretsmanager.LookupSecretVersionOutput(ctx, secretsmanager.LookupSecretVersionOutputArgs{
+		SecretId: pulumi.String(args.CredentialsSecretArn),
+	})
+
+	username := secret.SecretString().ApplyT(func(value string) (string, error) {
+		var credentials struct {
+			Username string `json:"username"`
+		}
+
+		err := json.Unmarshal([]byte(value), &credentials)
+		if err != nil || credentials.Username == "" {
+			return "", fmt.Errorf("existingDbCredentialsSecretArn %s must hold JSON with a username key; set existingDbUsername otherwise", args.CredentialsSecretArn)
+		}
+
+		return credentials.Username, nil
+	}).(pulumi.StringOutput)
+
+	return pulumi.Unsecret(username).(pulumi.StringOutput)
+}
+
+type ExistingDatabaseArgs struct {
+	Endpoint             string
+	Port                 int
+	Name                 string
+	Username             string
+	SecurityGroupId      string
+	CredentialsSecretArn string
+	CredentialsKmsKeyArn string
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/kms"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Create a customer managed KMS key, with rotation enabled, used to encrypt Pulumi data at rest.
+// CloudWatch Logs needs an explicit grant in the key policy before it can encrypt log groups with the key.
+func NewDataKmsKey(ctx *pulumi.Context, name string, region string, accountId string, opts ...pulumi.ResourceOption) (*kms.Key, error) {
+	rootArn := common.GetIamPolicyArn(region, fmt.Sprintf("arn:aws:iam::%s:root", accountId))
+	logsArn := common.GetIamPolicyArn(region, fmt.Sprintf("arn:aws:logs:%s:%s:*", region, accountId))
+
+	policy, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{
+			{
+				"Sid":       "EnableAccountPermissions",
+				"Effect":    "Allow",
+				"Principal": map[string]any{"AWS": rootArn},
+				"Action":    "kms:*",
+				"Resource":  "*",
+			},
+			{
+				"Sid":       "AllowCloudWatchLogs",
+				"Effect":    "Allow",
+				"Principal": map[string]any{"Service": fmt.Sprintf("logs.%s.amazonaws.com", region)},
+				"Action": []string{
+					"kms:Encrypt*",
+					"kms:Decrypt*",
+					"kms:ReEncrypt*",
+					"kms:GenerateDataKey*",
+					"kms:Describe*",
+				},
+				"Resource": "*",
+				"Condition": map[string]any{
+					"ArnLike": map[string]any{
+						"kms:EncryptionContext:aws:logs:arn": logsArn,
+					},
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := kms.NewKey(ctx, name, &kms.KeyArgs{
+		Description:          pulumi.String("Pulumi self-hosted data encryption key"),
+		EnableKeyRotation:    pulumi.Bool(true),
+		DeletionWindowInDays: pulumi.Int(30),
+		Policy:               pulumi.String(string(policy)),
+	}, append(opts, pulumi.Protect(true))...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -20,37 +20,135 @@ func main() {
 			return err
 		}
 
-		// retrieve VPC to populate the CIDR block of the VPCE SG ingress
-		vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{
-			Id: &config.VpcId,
-		})
+		name := config.CommonName
 
+		err = common.RegisterDefaultTags(ctx, config.Tags)
 		if err != nil {
 			return err
 		}
 
-		name := config.CommonName
+		// networking is either provided by the user (default) or created by this stack when no vpcId is configured
+		var vpcId pulumi.StringOutput
+		var vpcCidrBlock string
+		var publicSubnetIds, privateSubnetIds, isolatedSubnetIds pulumi.StringArrayOutput
+		var privateRouteTableIds pulumi.StringArrayInput
+		privateSubnetCount := len(config.PrivateSubnetIds)
 
-		database, err := NewDatabase(ctx, getCommonName(name, "database"), &DatabaseArgs{
-			vpcId:             pulumi.String(config.VpcId),
-			isolatedSubnetIds: pulumi.ToStringArray(config.IsolatedSubnetIds),
-			numberDbReplicas:  config.NumberDbReplicas,
-			instanceType:      pulumi.String(config.DbInstanceType),
-			region:            config.Region,
-		})
+		if config.CreateVpc {
+			network, err := NewNetwork(ctx, getCommonName(name, "network"), &NetworkArgs{
+				CidrBlock:             config.VpcCidrBlock,
+				AvailabilityZoneCount: config.VpcAvailabilityZoneCount,
+				DisableNatGateways:    config.EnableNatlessMode,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			vpcId = network.VpcId
+			vpcCidrBlock = config.VpcCidrBlock
+			publicSubnetIds = network.PublicSubnetIds
+			privateSubnetIds = network.PrivateSubnetIds
+			isolatedSubnetIds = network.IsolatedSubnetIds
+			privateSubnetCount = config.VpcAvailabilityZoneCount
+
+			if config.EnableNatlessMode {
+				privateRouteTableIds = network.PrivateRouteTableIds
+			}
+		} else {
+			// retrieve VPC to populate the CIDR block of the VPCE SG ingress
+			vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{
+				Id: &config.VpcId,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			vpcId = pulumi.String(config.VpcId).ToStringOutput()
+			vpcCidrBlock = vpc.CidrBlock
+			publicSubnetIds = pulumi.ToStringArray(config.PublicSubnetIds).ToStringArrayOutput()
+			privateSubnetIds = pulumi.ToStringArray(config.PrivateSubnetIds).ToStringArrayOutput()
+			isolatedSubnetIds = pulumi.ToStringArray(config.IsolatedSubnetIds).ToStringArrayOutput()
+
+			if config.EnableNatlessMode {
+				privateRouteTableIds, err = lookupPrivateRouteTables(ctx, config.VpcId, config.PrivateSubnetIds)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// nil when no customer managed key is configured; AWS managed keys will be used
+		var dataKmsKeyArn pulumi.StringPtrInput
+		exportedKmsKeyArn := pulumi.String(config.DataKmsKeyArn).ToStringOutput()
+		if config.DataKmsKeyArn != "" {
+			dataKmsKeyArn = pulumi.String(config.DataKmsKeyArn)
+		} else if config.CreateDataKmsKey {
+			key, err := NewDataKmsKey(ctx, getCommonName(name, "data-key"), config.Region, config.AccountId)
+			if err != nil {
+				return err
+			}
+
+			dataKmsKeyArn = key.Arn
+			exportedKmsKeyArn = key.Arn
+		}
+
+		var database *Database
+		if config.UseExistingDb {
+			database, err = NewExistingDatabase(ctx, &ExistingDatabaseArgs{
+				Endpoint:             config.ExistingDbEndpoint,
+				Port:                 config.ExistingDbPort,
+				Name:                 config.ExistingDbName,
+				Username:             config.ExistingDbUsername,
+				SecurityGroupId:      config.ExistingDbSecurityGroupId,
+				CredentialsSecretArn: config.ExistingDbCredentialsSecretArn,
+				CredentialsKmsKeyArn: config.ExistingDbCredentialsKmsKeyArn,
+			})
+		} else {
+			database, err = NewDatabase(ctx, getCommonName(name, "database"), &DatabaseArgs{
+				vpcId:                 vpcId,
+				isolatedSubnetIds:     isolatedSubnetIds,
+				numberDbReplicas:      config.NumberDbReplicas,
+				replicaInstanceTypes:  config.DbReplicaInstanceTypes,
+				replicaAutoscaling:    config.EnableDbReplicaAutoscaling,
+				replicaAutoscalingMin: config.DbReplicaAutoscalingMin,
+				replicaAutoscalingMax: config.DbReplicaAutoscalingMax,
+				replicaAutoscalingCpu: config.DbReplicaAutoscalingTargetCpu,
+				instanceType:          pulumi.String(config.DbInstanceType),
+				region:                config.Region,
+				serverless:            config.EnableDbServerless,
+				serverlessMinCapacity: config.DbServerlessMinCapacity,
+				serverlessMaxCapacity: config.DbServerlessMaxCapacity,
+				enableProxy:           config.EnableDbProxy,
+				passwordRotationDays:  config.DbPasswordRotationDays,
+				awsSettings:           config.AwsSettings,
+				engineVersion:         config.DbEngineVersion,
+				blueGreenUpgrade:      config.DbBlueGreenUpgrade,
+				snapshotIdentifier:    config.RestoreFromSnapshotIdentifier,
+				instanceParameters:    config.DbInstanceParameters,
+				clusterParameters:     config.DbClusterParameters,
+				vpcCidrBlock:          vpcCidrBlock,
+				kmsKeyArn:             dataKmsKeyArn,
+				drRegion:              config.DbDrRegion,
+				drVpcId:               config.DbDrVpcId,
+				drSubnetIds:           config.DbDrSubnetIds,
+				drKmsKeyArn:           config.DbDrKmsKeyArn,
+			})
+		}
 
 		if err != nil {
 			return err
 		}
 
 		endpointSecurityGroup, err := ec2.NewSecurityGroup(ctx, getCommonName(name, "endpoint-sg"), &ec2.SecurityGroupArgs{
-			VpcId: pulumi.String(config.VpcId),
+			VpcId: vpcId,
 			Ingress: ec2.SecurityGroupIngressArray{
 				ec2.SecurityGroupIngressArgs{
 					Protocol:   pulumi.String("-1"),
 					FromPort:   pulumi.Int(0),
 					ToPort:     pulumi.Int(0),
-					CidrBlocks: pulumi.StringArray{pulumi.String(vpc.CidrBlock)},
+					CidrBlocks: pulumi.StringArray{pulumi.String(vpcCidrBlock)},
 				},
 			},
 		})
@@ -60,9 +158,11 @@ func main() {
 		}
 
 		s3ServiceName := common.GetEnpointAddress(config.Region, fmt.Sprintf("com.amazonaws.%s.s3", config.Region))
+		// without NAT the private subnets only reach S3 (ECR image layers, service buckets) through routes to the gateway endpoint
 		s3Endpoint, err := ec2.NewVpcEndpoint(ctx, getCommonName(name, "s3-endpoint"), &ec2.VpcEndpointArgs{
-			VpcId:       pulumi.String(config.VpcId),
-			ServiceName: pulumi.String(s3ServiceName),
+			VpcId:         vpcId,
+			ServiceName:   pulumi.String(s3ServiceName),
+			RouteTableIds: privateRouteTableIds,
 		})
 
 		if err != nil {
@@ -73,105 +173,112 @@ func main() {
 			PrefixListId: s3Endpoint.PrefixListId,
 		}, nil)
 
-		dkrServiceName := common.GetEnpointAddress(config.Region, fmt.Sprintf("com.amazonaws.%s.ecr.dkr", config.Region))
-		_, err = ec2.NewVpcEndpoint(ctx, getCommonName(name, "ecr-dkr-endpoint"), &ec2.VpcEndpointArgs{
-			VpcId:             pulumi.String(config.VpcId),
-			ServiceName:       pulumi.String(dkrServiceName),
-			VpcEndpointType:   pulumi.String("Interface"),
-			PrivateDnsEnabled: pulumi.BoolPtr(true),
-			SecurityGroupIds:  pulumi.StringArray{endpointSecurityGroup.ID()},
-			SubnetIds:         pulumi.ToStringArray(config.PrivateSubnetIds),
+		vpcEndpointIds, err := NewVpcEndpoints(ctx, name, &VpcEndpointsArgs{
+			Region:          config.Region,
+			Services:        config.VpcEndpoints,
+			VpcId:           vpcId,
+			SubnetIds:       privateSubnetIds,
+			SecurityGroupId: endpointSecurityGroup.ID(),
 		})
 
 		if err != nil {
 			return err
 		}
 
-		ecrServiceName := common.GetEnpointAddress(config.Region, fmt.Sprintf("com.amazonaws.%s.ecr.api", config.Region))
-		_, err = ec2.NewVpcEndpoint(ctx, getCommonName(name, "ecr-api-endpoint"), &ec2.VpcEndpointArgs{
-			VpcId:             pulumi.String(config.VpcId),
-			ServiceName:       pulumi.String(ecrServiceName),
-			VpcEndpointType:   pulumi.String("Interface"),
-			PrivateDnsEnabled: pulumi.BoolPtr(true),
-			SecurityGroupIds:  pulumi.StringArray{endpointSecurityGroup.ID()},
-			SubnetIds:         pulumi.ToStringArray(config.PrivateSubnetIds),
-		})
+		// the S3 gateway endpoint is always created; the application stack relies on its prefix list
+		vpcEndpointIds[common.S3GatewayVpcEndpoint] = s3Endpoint.ID()
 
-		if err != nil {
-			return err
-		}
-
-		smServiceName := common.GetEnpointAddress(config.Region, fmt.Sprintf("com.amazonaws.%s.secretsmanager", config.Region))
-		_, err = ec2.NewVpcEndpoint(ctx, getCommonName(name, "secrets-manager-endpoint"), &ec2.VpcEndpointArgs{
-			VpcId:             pulumi.String(config.VpcId),
-			ServiceName:       pulumi.String(smServiceName),
-			VpcEndpointType:   pulumi.String("Interface"),
-			PrivateDnsEnabled: pulumi.BoolPtr(true),
-			SecurityGroupIds:  pulumi.StringArray{endpointSecurityGroup.ID()},
-			SubnetIds:         pulumi.ToStringArray(config.PrivateSubnetIds),
-		})
-
-		if err != nil {
-			return err
-		}
-
-		cwServiceName := common.GetEnpointAddress(config.Region, fmt.Sprintf("com.amazonaws.%s.logs", config.Region))
-		_, err = ec2.NewVpcEndpoint(ctx, getCommonName(name, "cloudwatch-endpoint"), &ec2.VpcEndpointArgs{
-			VpcId:             pulumi.String(config.VpcId),
-			ServiceName:       pulumi.String(cwServiceName),
-			VpcEndpointType:   pulumi.String("Interface"),
-			PrivateDnsEnabled: pulumi.BoolPtr(true),
-			SecurityGroupIds:  pulumi.StringArray{endpointSecurityGroup.ID()},
-			SubnetIds:         pulumi.ToStringArray(config.PrivateSubnetIds),
-		})
-
-		if err != nil {
-			return err
-		}
-
-		elbServicName := common.GetEnpointAddress(config.Region, fmt.Sprintf("com.amazonaws.%s.elasticloadbalancing", config.Region))
-		_, err = ec2.NewVpcEndpoint(ctx, getCommonName(name, "elb-endpoint"), &ec2.VpcEndpointArgs{
-			VpcId:             pulumi.String(config.VpcId),
-			ServiceName:       pulumi.String(elbServicName),
-			VpcEndpointType:   pulumi.String("Interface"),
-			PrivateDnsEnabled: pulumi.BoolPtr(true),
-			SecurityGroupIds:  pulumi.StringArray{endpointSecurityGroup.ID()},
-			SubnetIds:         pulumi.ToStringArray(config.PrivateSubnetIds),
-		})
-
-		if err != nil {
-			return err
-		}
+		var OpenSearchDomain *OpenSearch
+		if config.UseOpenSearchContainer {
+			OpenSearchDomain, err = NewOpenSearchContainer(ctx, getCommonName(name, "opensearch"), &OpenSearchContainerArgs{
+				Region:       config.Region,
+				DomainName:   config.OpenSearchDomainName,
+				Image:        config.OpenSearchContainerImage,
+				Cpu:          config.OpenSearchContainerCpu,
+				Memory:       config.OpenSearchContainerMemory,
+				VpcId:        vpcId,
+				VpcCidrBlock: vpcCidrBlock,
+				SubnetIds:    privateSubnetIds,
+				SubnetCount:  privateSubnetCount,
+				KmsKeyArn:    dataKmsKeyArn,
+			})
+		} else if config.UseOpenSearchServerless {
+			OpenSearchDomain, err = NewOpenSearchServerless(ctx, getCommonName(name, "opensearch"), &OpenSearchServerlessArgs{
+				CollectionName: config.OpenSearchDomainName,
+				VpcId:          vpcId,
+				VpcCidrBlock:   vpcCidrBlock,
+				SubnetIds:      privateSubnetIds,
+				KmsKeyArn:      dataKmsKeyArn,
+			})
+		} else {
+			// a created VPC can span more zones than there are instances; the domain only uses one subnet per instance
+			openSearchSubnetIds := privateSubnetIds
+			openSearchSubnetCount := privateSubnetCount
+			if config.CreateVpc {
+				openSearchSubnetCount = min(privateSubnetCount, config.OpenSearchInstanceCount)
+				openSearchSubnetIds = privateSubnetIds.ApplyT(func(ids []string) []string {
+					return ids[:openSearchSubnetCount]
+				}).(pulumi.StringArrayOutput)
+			}
 
-		OpenSearchArgs := &OpenSearchArgs{
-			DeployOpenSearch:     config.EnableOpenSearch,
-			InstanceType:         config.OpenSearchInstanceType,
-			InstanceCount:        config.OpenSearchInstanceCount,
-			DomainName:           config.OpenSearchDomainName,
-			DedicatedMasterCount: config.OpenSearchDedicatedMasterCount,
-			VpcId:                config.VpcId,
-			SubnetIds:            config.PrivateSubnetIds,
-			AccountId:            config.AccountId,
-			Region:               config.Region,
+			OpenSearchDomain, err = NewOpenSearch(ctx, getCommonName(name, "opensearch"), &OpenSearchArgs{
+				DeployOpenSearch:       config.EnableOpenSearch,
+				InstanceType:           config.OpenSearchInstanceType,
+				InstanceCount:          config.OpenSearchInstanceCount,
+				DomainName:             config.OpenSearchDomainName,
+				DedicatedMasterCount:   config.OpenSearchDedicatedMasterCount,
+				DedicatedMasterType:    config.OpenSearchDedicatedMasterType,
+				EngineVersion:          config.OpenSearchEngineVersion,
+				VolumeType:             config.OpenSearchVolumeType,
+				VolumeSize:             config.OpenSearchVolumeSize,
+				VolumeIops:             config.OpenSearchVolumeIops,
+				VolumeThroughput:       config.OpenSearchVolumeThroughput,
+				WarmCount:              config.OpenSearchWarmCount,
+				WarmType:               config.OpenSearchWarmType,
+				ColdStorage:            config.OpenSearchEnableColdStorage,
+				IamMasterUser:          config.OpenSearchIamMasterUser,
+				EnableSnapshots:        config.OpenSearchEnableSnapshots,
+				SnapshotSchedule:       config.OpenSearchSnapshotSchedule,
+				SnapshotRetentionCount: config.OpenSearchSnapshotRetentionCount,
+				IsmIndexPatterns:       config.OpenSearchIsmIndexPatterns,
+				RolloverDays:           config.OpenSearchRolloverDays,
+				IndexRetentionDays:     config.OpenSearchIndexRetentionDays,
+				VpcId:                  vpcId,
+				VpcCidrBlock:           vpcCidrBlock,
+				SubnetIds:              openSearchSubnetIds,
+				SubnetCount:            openSearchSubnetCount,
+				AccountId:              config.AccountId,
+				Region:                 config.Region,
+				KmsKeyArn:              dataKmsKeyArn,
+			})
 		}
 
-		OpenSearchDomain, err := NewOpenSearch(ctx, getCommonName(name, "opensearch"), OpenSearchArgs)
 		if err != nil {
 			return err
 		}
 
-		ctx.Export("vpcId", pulumi.String(config.VpcId))
-		ctx.Export("publicSubnetIds", pulumi.ToStringArray(config.PublicSubnetIds))
-		ctx.Export("privateSubnetIds", pulumi.ToStringArray(config.PrivateSubnetIds))
-		ctx.Export("isolatedSubnetIds", pulumi.ToStringArray(config.IsolatedSubnetIds))
+		ctx.Export("vpcId", vpcId)
+		ctx.Export("publicSubnetIds", publicSubnetIds)
+		ctx.Export("privateSubnetIds", privateSubnetIds)
+		ctx.Export("isolatedSubnetIds", isolatedSubnetIds)
 		ctx.Export("dbClusterEndpoint", database.dbClusterEndpoint)
+		ctx.Export("dbProxyEndpoint", database.dbProxyEndpoint)
 		ctx.Export("dbPort", database.dbPort)
 		ctx.Export("dbName", database.dbName)
 		ctx.Export("dbUsername", database.dbUsername)
-		ctx.Export("dbPassword", pulumi.ToSecret(database.dbPassword))
+		ctx.Export("dbActiveEnvironment", database.dbActiveEnvironment)
+		ctx.Export("dbCredentialsSecretArn", database.dbCredentialsSecretArn)
+		ctx.Export("dbCredentialsKmsKeyArn", database.dbCredentialsKmsKeyArn)
 		ctx.Export("dbSecurityGroupId", database.dbSecurityGroupId)
+		ctx.Export("dataKmsKeyArn", exportedKmsKeyArn)
 		ctx.Export("endpointSecurityGroupId", endpointSecurityGroup.ID())
 		ctx.Export("s3EndpointPrefixId", privateS3PrefixList.Id())
+		ctx.Export("vpcEndpointIds", vpcEndpointIds)
+		ctx.Export("natlessMode", pulumi.Bool(config.EnableNatlessMode))
+		if config.DbDrRegion != "" {
+			ctx.Export("dbDrRegion", pulumi.String(config.DbDrRegion))
+			ctx.Export("dbDrReaderEndpoint", database.dbDrReaderEndpoint)
+		}
 		if OpenSearchDomain != nil {
 			ctx.Export("opensearchDomainName", OpenSearchDomain.DomainName)
 			ctx.Export("opensearchEndpoint", OpenSearchDomain.Endpoint)
@@ -183,6 +290,14 @@ func main() {
 			ctx.Export("opensearchUser", pulumi.String(""))
 			ctx.Export("opensearchPassword", pulumi.String(""))
 		}
+		// the application stack runs the API with these so it can reach the managed domain
+		if OpenSearchDomain != nil && OpenSearchDomain.ApiRole != nil {
+			ctx.Export("apiTaskRoleName", OpenSearchDomain.ApiRole.Name)
+			ctx.Export("apiTaskRoleArn", OpenSearchDomain.ApiRole.Arn)
+			ctx.Export("apiSecurityGroupId", OpenSearchDomain.ApiSecurityGroup.ID())
+		}
+		ctx.Export("opensearchIamMasterUser", pulumi.Bool(config.OpenSearchIamMasterUser))
+		ctx.Export("opensearchServerless", pulumi.Bool(config.UseOpenSearchServerless))
 
 		return nil
 	})
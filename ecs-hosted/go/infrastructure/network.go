@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// each tier reserves 4 subnet slots (one per AZ) of the VPC CIDR; public, private, then isolated
+const subnetNewBits = 4
+const subnetSlotsPerTier = 4
+
+/*
+Create a multi-AZ VPC for use when the user has not provided their own
+Public subnets route to an Internet Gateway and host a NAT Gateway per AZ
+Private subnets route egress through the NAT Gateway in their AZ
+Isolated subnets only have the local VPC route
+With NAT disabled the private subnets also only have the local VPC route; AWS services must then be reached through VPC endpoints
+*/
+func NewNetwork(ctx *pulumi.Context, name string, args *NetworkArgs, opts ...pulumi.ResourceOption) (*Network, error) {
+	var resource Network
+
+	if args.AvailabilityZoneCount < 2 || args.AvailabilityZoneCount > subnetSlotsPerTier {
+		return nil, fmt.Errorf("availability zone count must be between 2 and %d", subnetSlotsPerTier)
+	}
+
+	azs, err := aws.GetAvailabilityZones(ctx, &aws.GetAvailabilityZonesArgs{
+		State: pulumi.StringRef("available"),
+	}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(azs.Names) < args.AvailabilityZoneCount {
+		return nil, fmt.Errorf("region only has %d available availability zones, %d requested", len(azs.Names), args.AvailabilityZoneCount)
+	}
+
+	err = ctx.RegisterComponentResource("pulumi:network", name, &resource, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// create our parented options
+	options := append(opts, pulumi.Parent(&resource))
+
+	// DNS support and hostnames are required for private DNS on the interface VPC endpoints
+	vpc, err := ec2.NewVpc(ctx, ToCommonName(name, "vpc"), &ec2.VpcArgs{
+		CidrBlock:          pulumi.String(args.CidrBlock),
+		EnableDnsHostnames: pulumi.Bool(true),
+		EnableDnsSupport:   pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(name),
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	igw, err := ec2.NewInternetGateway(ctx, ToCommonName(name, "igw"), &ec2.InternetGatewayArgs{
+		VpcId: vpc.ID(),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	publicRouteTable, err := ec2.NewRouteTable(ctx, ToCommonName(name, "public-rt"), &ec2.RouteTableArgs{
+		VpcId: vpc.ID(),
+		Routes: ec2.RouteTableRouteArray{
+			&ec2.RouteTableRouteArgs{
+				CidrBlock: pulumi.String("0.0.0.0/0"),
+				GatewayId: igw.ID(),
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// isolated subnets share a single route table with only the implicit local route
+	isolatedRouteTable, err := ec2.NewRouteTable(ctx, ToCommonName(name, "isolated-rt"), &ec2.RouteTableArgs{
+		VpcId: vpc.ID(),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var publicSubnetIds, privateSubnetIds, isolatedSubnetIds, privateRouteTableIds pulumi.StringArray
+
+	for i := 0; i < args.AvailabilityZoneCount; i++ {
+		az := azs.Names[i]
+
+		publicSubnet, err := newTierSubnet(ctx, name, "public", i, az, vpc, args.CidrBlock, publicRouteTable, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		// each AZ gets its own private route table so egress stays in-zone and survives the loss of a single NAT Gateway
+		privateRoutes := ec2.RouteTableRouteArray{}
+		if !args.DisableNatGateways {
+			nat, err := newNatGateway(ctx, name, i, publicSubnet, igw, options...)
+			if err != nil {
+				return nil, err
+			}
+
+			privateRoutes = append(privateRoutes, &ec2.RouteTableRouteArgs{
+				CidrBlock:    pulumi.String("0.0.0.0/0"),
+				NatGatewayId: nat.ID(),
+			})
+		}
+
+		privateRouteTable, err := ec2.NewRouteTable(ctx, ToCommonName(name, fmt.Sprintf("private-rt-%d", i)), &ec2.RouteTableArgs{
+			VpcId:  vpc.ID(),
+			Routes: privateRoutes,
+		}, options...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		privateSubnet, err := newTierSubnet(ctx, name, "private", i, az, vpc, args.CidrBlock, privateRouteTable, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		isolatedSubnet, err := newTierSubnet(ctx, name, "isolated", i, az, vpc, args.CidrBlock, isolatedRouteTable, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		publicSubnetIds = append(publicSubnetIds, publicSubnet.ID().ToStringOutput())
+		privateSubnetIds = append(privateSubnetIds, privateSubnet.ID().ToStringOutput())
+		isolatedSubnetIds = append(isolatedSubnetIds, isolatedSubnet.ID().ToStringOutput())
+		privateRouteTableIds = append(privateRouteTableIds, privateRouteTable.ID().ToStringOutput())
+	}
+
+	resource.VpcId = vpc.ID().ToStringOutput()
+	resource.PublicSubnetIds = publicSubnetIds.ToStringArrayOutput()
+	resource.PrivateSubnetIds = privateSubnetIds.ToStringArrayOutput()
+	resource.IsolatedSubnetIds = isolatedSubnetIds.ToStringArrayOutput()
+	resource.PrivateRouteTableIds = privateRouteTableIds.ToStringArrayOutput()
+
+	return &resource, nil
+}
+
+// create a NAT Gateway, and its Elastic IP, in the public subnet of the given AZ
+func newNatGateway(ctx *pulumi.Context, name string, index int, publicSubnet *ec2.Subnet, igw *ec2.InternetGateway, options ...pulumi.ResourceOption) (*ec2.NatGateway, error) {
+	eip, err := ec2.NewEip(ctx, ToCommonName(name, fmt.Sprintf("nat-eip-%d", index)), &ec2.EipArgs{
+		Domain: pulumi.String("vpc"),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	natOptions := append(options, pulumi.DependsOn([]pulumi.Resource{igw}))
+	return ec2.NewNatGateway(ctx, ToCommonName(name, fmt.Sprintf("nat-%d", index)), &ec2.NatGatewayArgs{
+		AllocationId: eip.ID(),
+		SubnetId:     publicSubnet.ID(),
+	}, natOptions...)
+}
+
+// create a subnet in the given tier and AZ and associate it with the tier's route table
+func newTierSubnet(ctx *pulumi.Context, name string, tier string, index int, az string, vpc *ec2.Vpc, vpcCidrBlock string, routeTable *ec2.RouteTable, options ...pulumi.ResourceOption) (*ec2.Subnet, error) {
+	tierOffset := map[string]int{
+		"public":   0,
+		"private":  1,
+		"isolated": 2,
+	}[tier]
+
+	cidr, err := common.CidrSubnet(vpcCidrBlock, subnetNewBits, tierOffset*subnetSlotsPerTier+index)
+	if err != nil {
+		return nil, err
+	}
+
+	subnetName := ToCommonName(name, fmt.Sprintf("%s-%d", tier, index))
+	subnet, err := ec2.NewSubnet(ctx, subnetName, &ec2.SubnetArgs{
+		VpcId:               vpc.ID(),
+		CidrBlock:           pulumi.String(cidr),
+		AvailabilityZone:    pulumi.String(az),
+		MapPublicIpOnLaunch: pulumi.Bool(tier == "public"),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(subnetName),
+			"tier": pulumi.String(tier),
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ec2.NewRouteTableAssociation(ctx, ToCommonName(subnetName, "rta"), &ec2.RouteTableAssociationArgs{
+		SubnetId:     subnet.ID(),
+		RouteTableId: routeTable.ID(),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return subnet, nil
+}
+
+type NetworkArgs struct {
+	CidrBlock             string
+	AvailabilityZoneCount int
+	DisableNatGateways    bool
+}
+
+type Network struct {
+	pulumi.ResourceState
+
+	VpcId                pulumi.StringOutput
+	PublicSubnetIds      pulumi.StringArrayOutput
+	PrivateSubnetIds     pulumi.StringArrayOutput
+	IsolatedSubnetIds    pulumi.StringArrayOutput
+	PrivateRouteTableIds pulumi.StringArrayOutput
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
 	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/opensearch"
 	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
@@ -13,15 +15,34 @@ import (
 )
 
 type OpenSearchArgs struct {
-	AccountId            string
-	Region               string
-	DomainName           string
-	DeployOpenSearch     bool
-	InstanceType         string
-	InstanceCount        int
-	VpcId                string
-	SubnetIds            []string
-	DedicatedMasterCount int
+	AccountId              string
+	Region                 string
+	DomainName             string
+	DeployOpenSearch       bool
+	InstanceType           string
+	InstanceCount          int
+	VpcId                  pulumi.StringOutput
+	VpcCidrBlock           string
+	SubnetIds              pulumi.StringArrayOutput
+	SubnetCount            int
+	DedicatedMasterCount   int
+	DedicatedMasterType    string
+	EngineVersion          string
+	VolumeType             string
+	VolumeSize             int
+	VolumeIops             int
+	VolumeThroughput       int
+	WarmCount              int
+	WarmType               string
+	ColdStorage            bool
+	IamMasterUser          bool
+	EnableSnapshots        bool
+	SnapshotSchedule       string
+	SnapshotRetentionCount int
+	IsmIndexPatterns       []string
+	RolloverDays           int
+	IndexRetentionDays     int
+	KmsKeyArn              pulumi.StringPtrInput
 }
 
 func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts ...pulumi.ResourceOption) (*OpenSearch, error) {
@@ -33,7 +54,7 @@ func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts
 
 	un := "admin"
 
-	err := validateNetworkConfiguration(args.SubnetIds, args.InstanceCount)
+	err := validateNetworkConfiguration(args.SubnetCount, args.InstanceCount)
 
 	if err != nil {
 		return nil, err
@@ -50,19 +71,42 @@ func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts
 	// open search has a specific domain name so we need to specify deleteBeforeReplace
 	OpenSearchOpts := append(options, pulumi.Timeouts(&pulumi.CustomTimeouts{Create: "5h"}), pulumi.DeleteBeforeReplace(true))
 
-	sg, err := ec2.NewSecurityGroup(ctx, name, &ec2.SecurityGroupArgs{
-		VpcId: pulumi.String(args.VpcId),
-		Ingress: ec2.SecurityGroupIngressArray{
-			&ec2.SecurityGroupIngressArgs{
-				Protocol: pulumi.String("tcp"),
-				FromPort: pulumi.Int(443),
-				ToPort:   pulumi.Int(443),
-				// TODO: we should have the cide of the VPC or at least we should be able to get it
-				CidrBlocks: pulumi.StringArray{
-					pulumi.String("0.0.0.0/0"),
-				},
-			},
+	// the application stack runs the API with this role and security group; the domain's security group admits nothing else
+	resource.ApiRole, resource.ApiSecurityGroup, err = newOpenSearchApiAccess(ctx, name, args, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	ingress := ec2.SecurityGroupIngressArray{
+		&ec2.SecurityGroupIngressArgs{
+			Protocol:       pulumi.String("tcp"),
+			FromPort:       pulumi.Int(443),
+			ToPort:         pulumi.Int(443),
+			SecurityGroups: pulumi.StringArray{resource.ApiSecurityGroup.ID()},
+			Description:    pulumi.String("Allow the Pulumi API to connect to OpenSearch"),
 		},
+	}
+
+	// the snapshot setup function connects from its own security group
+	var setupSg *ec2.SecurityGroup
+	if args.EnableSnapshots {
+		setupSg, err = newOpenSearchSetupSecurityGroup(ctx, name, args, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		ingress = append(ingress, &ec2.SecurityGroupIngressArgs{
+			Protocol:       pulumi.String("tcp"),
+			FromPort:       pulumi.Int(443),
+			ToPort:         pulumi.Int(443),
+			SecurityGroups: pulumi.StringArray{setupSg.ID()},
+			Description:    pulumi.String("Allow the setup function to connect to OpenSearch"),
+		})
+	}
+
+	sg, err := ec2.NewSecurityGroup(ctx, name, &ec2.SecurityGroupArgs{
+		VpcId:   args.VpcId,
+		Ingress: ingress,
 	}, options...)
 
 	if err != nil {
@@ -75,7 +119,7 @@ func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts
 	}
 
 	zae := false
-	if len(args.SubnetIds) > 1 {
+	if args.SubnetCount > 1 {
 		zae = true
 	}
 
@@ -102,49 +146,108 @@ func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts
 		},
 	}
 
+	clusterConfig := &opensearch.DomainClusterConfigArgs{
+		InstanceType:           pulumi.String(args.InstanceType),
+		InstanceCount:          pulumi.Int(args.InstanceCount),
+		DedicatedMasterEnabled: pulumi.Bool(dme),
+		ZoneAwarenessEnabled:   pulumi.Bool(zae),
+		ZoneAwarenessConfig: &opensearch.DomainClusterConfigZoneAwarenessConfigArgs{
+			AvailabilityZoneCount: pulumi.Int(args.SubnetCount),
+		},
+	}
+
+	if dme {
+		clusterConfig.DedicatedMasterCount = pulumi.Int(args.DedicatedMasterCount)
+		clusterConfig.DedicatedMasterType = pulumi.String(args.DedicatedMasterType)
+	}
+
+	if args.WarmCount > 0 {
+		clusterConfig.WarmEnabled = pulumi.Bool(true)
+		clusterConfig.WarmCount = pulumi.Int(args.WarmCount)
+		clusterConfig.WarmType = pulumi.String(args.WarmType)
+	}
+
+	if args.ColdStorage {
+		clusterConfig.ColdStorageOptions = &opensearch.DomainClusterConfigColdStorageOptionsArgs{
+			Enabled: pulumi.Bool(true),
+		}
+	}
+
+	// IOPS and throughput are left to the volume type's defaults unless provided
+	ebsOptions := &opensearch.DomainEbsOptionsArgs{
+		EbsEnabled: pulumi.Bool(true),
+		VolumeSize: pulumi.Int(args.VolumeSize),
+		VolumeType: pulumi.String(args.VolumeType),
+	}
+
+	if args.VolumeIops > 0 {
+		ebsOptions.Iops = pulumi.Int(args.VolumeIops)
+	}
+
+	if args.VolumeThroughput > 0 {
+		ebsOptions.Throughput = pulumi.Int(args.VolumeThroughput)
+	}
+
 	// autotune is not supported for burstable instances
 	if strings.HasPrefix(args.InstanceType, "t2") || strings.HasPrefix(args.InstanceType, "t3") {
 		autotuneOptions = nil
 	}
 
-	lg, err := newLogGroup(ctx, name, options...)
+	lg, err := newLogGroup(ctx, name, args.KmsKeyArn, options...)
 	if err != nil {
 		return nil, err
 	}
 
-	pw, err := random.NewRandomPassword(ctx, getCommonName(name, "pw"), &random.RandomPasswordArgs{
-		Length: pulumi.Int(16),
-	}, options...)
-
-	if err != nil {
-		return nil, err
+	// by default the API signs in with the internal admin user over basic auth, which fine-grained access control only accepts through an open principal
+	// so the policy is not narrowed to the API role here; the security group limits who can connect and the policy only allows HTTP calls, not configuration changes
+	var securityOptions *opensearch.DomainAdvancedSecurityOptionsArgs
+	var accessPolicies pulumi.StringInput
+	var pw *random.RandomPassword
+	if args.IamMasterUser {
+		// opt-in: the API role is the master user and the only principal, so the API signs its requests with the task role credentials
+		securityOptions = &opensearch.DomainAdvancedSecurityOptionsArgs{
+			Enabled: pulumi.Bool(true),
+			MasterUserOptions: &opensearch.DomainAdvancedSecurityOptionsMasterUserOptionsArgs{
+				MasterUserArn: resource.ApiRole.Arn,
+			},
+		}
+		accessPolicies = resource.ApiRole.Arn.ApplyT(func(arn string) string {
+			return openSearchAccessPolicy(args, fmt.Sprintf("%q", arn))
+		}).(pulumi.StringOutput)
+	} else {
+		pw, err = random.NewRandomPassword(ctx, getCommonName(name, "pw"), &random.RandomPasswordArgs{
+			Length: pulumi.Int(16),
+		}, options...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		securityOptions = &opensearch.DomainAdvancedSecurityOptionsArgs{
+			Enabled:                     pulumi.Bool(true),
+			InternalUserDatabaseEnabled: pulumi.Bool(true),
+			MasterUserOptions: &opensearch.DomainAdvancedSecurityOptionsMasterUserOptionsArgs{
+				MasterUserName:     pulumi.String(un),
+				MasterUserPassword: pw.Result,
+			},
+		}
+		accessPolicies = pulumi.String(openSearchAccessPolicy(args, `"*"`))
 	}
 
 	domain, err := opensearch.NewDomain(ctx, name, &opensearch.DomainArgs{
 		DomainName:    pulumi.String(args.DomainName),
-		EngineVersion: pulumi.String("OpenSearch_2.13"),
-		ClusterConfig: &opensearch.DomainClusterConfigArgs{
-			InstanceType:           pulumi.String(args.InstanceType),
-			InstanceCount:          pulumi.Int(args.InstanceCount),
-			DedicatedMasterEnabled: pulumi.Bool(dme),
-			ZoneAwarenessEnabled:   pulumi.Bool(zae),
-			ZoneAwarenessConfig: &opensearch.DomainClusterConfigZoneAwarenessConfigArgs{
-				AvailabilityZoneCount: pulumi.Int(len(args.SubnetIds)),
-			},
-		},
-		EbsOptions: &opensearch.DomainEbsOptionsArgs{
-			EbsEnabled: pulumi.Bool(true),
-			VolumeSize: pulumi.Int(10),
-			VolumeType: pulumi.String("gp2"),
-		},
+		EngineVersion: pulumi.String(args.EngineVersion),
+		ClusterConfig: clusterConfig,
+		EbsOptions:    ebsOptions,
 		VpcOptions: &opensearch.DomainVpcOptionsArgs{
 			SecurityGroupIds: pulumi.StringArray{
 				sg.ID(),
 			},
-			SubnetIds: pulumi.ToStringArray(args.SubnetIds),
+			SubnetIds: args.SubnetIds,
 		},
 		EncryptAtRest: &opensearch.DomainEncryptAtRestArgs{
-			Enabled: pulumi.Bool(true),
+			Enabled:  pulumi.Bool(true),
+			KmsKeyId: args.KmsKeyArn,
 		},
 		NodeToNodeEncryption: &opensearch.DomainNodeToNodeEncryptionArgs{
 			Enabled: pulumi.Bool(true),
@@ -153,15 +256,8 @@ func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts
 			EnforceHttps:      pulumi.Bool(true),
 			TlsSecurityPolicy: pulumi.String("Policy-Min-TLS-1-2-2019-07"),
 		},
-		AdvancedSecurityOptions: &opensearch.DomainAdvancedSecurityOptionsArgs{
-			Enabled:                     pulumi.Bool(true),
-			InternalUserDatabaseEnabled: pulumi.Bool(true),
-			MasterUserOptions: &opensearch.DomainAdvancedSecurityOptionsMasterUserOptionsArgs{
-				MasterUserName:     pulumi.String(un),
-				MasterUserPassword: pw.Result,
-			},
-		},
-		AutoTuneOptions: autotuneOptions,
+		AdvancedSecurityOptions: securityOptions,
+		AutoTuneOptions:         autotuneOptions,
 		LogPublishingOptions: &opensearch.DomainLogPublishingOptionArray{
 			&opensearch.DomainLogPublishingOptionArgs{
 				CloudwatchLogGroupArn: lg.Arn,
@@ -180,25 +276,52 @@ func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts
 				LogType:               pulumi.String("AUDIT_LOGS"),
 			},
 		},
-		AccessPolicies: pulumi.String(fmt.Sprintf(`{
-			"Version": "2012-10-17",
-			"Statement": [{
-				"Effect": "Allow",
-				"Principal": {
-					"AWS": "*"
-				},
-				"Action": "es:*",
-				"Resource": "arn:aws:es:%s:%s:domain/%s/*"
-			}]
-		}`, args.Region, args.AccountId, args.DomainName)),
+		AccessPolicies: accessPolicies,
 	}, OpenSearchOpts...)
 
 	if err != nil {
 		return nil, err
 	}
 
-	resource.User = pulumi.String(un).ToStringOutput()
-	resource.Password = pw.Result
+	// the API may make HTTP calls to the domain whichever way it signs in
+	_, err = iam.NewRolePolicy(ctx, getCommonName(name, "api-search-policy"), &iam.RolePolicyArgs{
+		Role: resource.ApiRole.Name,
+		Policy: domain.Arn.ApplyT(func(arn string) (string, error) {
+			doc, err := json.Marshal(map[string]any{
+				"Version": "2012-10-17",
+				"Statement": []map[string]any{
+					{
+						"Effect":   "Allow",
+						"Action":   []string{"es:ESHttp*"},
+						"Resource": []string{fmt.Sprintf("%s/*", arn)},
+					},
+				},
+			})
+
+			return string(doc), err
+		}).(pulumi.StringOutput),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if args.IamMasterUser {
+		// there is no internal user; requests are signed with the API role
+		resource.User = pulumi.String("").ToStringOutput()
+		resource.Password = pulumi.String("").ToStringOutput()
+	} else {
+		if args.EnableSnapshots {
+			err = newOpenSearchSnapshots(ctx, name, args, domain, setupSg, un, pw.Result, options...)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resource.User = pulumi.String(un).ToStringOutput()
+		resource.Password = pw.Result
+	}
+
 	resource.DomainName = domain.DomainName
 	resource.Endpoint = domain.Endpoint.ApplyT(func(endpoint string) string {
 		return fmt.Sprintf("https://%s", endpoint)
@@ -207,16 +330,64 @@ func NewOpenSearch(ctx *pulumi.Context, name string, args *OpenSearchArgs, opts
 	return &resource, nil
 }
 
-func validateNetworkConfiguration(subnetIds []string, instanceCount int) error {
-	if len(subnetIds) > instanceCount {
+// only HTTP calls from the given principal are allowed; nothing may change the domain's configuration
+func openSearchAccessPolicy(args *OpenSearchArgs, principal string) string {
+	return fmt.Sprintf(`{
+		"Version": "2012-10-17",
+		"Statement": [{
+			"Effect": "Allow",
+			"Principal": {
+				"AWS": %s
+			},
+			"Action": "es:ESHttp*",
+			"Resource": "arn:aws:es:%s:%s:domain/%s/*"
+		}]
+	}`, principal, args.Region, args.AccountId, args.DomainName)
+}
+
+// task role and security group for the API service
+func newOpenSearchApiAccess(ctx *pulumi.Context, name string, args *OpenSearchArgs, options ...pulumi.ResourceOption) (*iam.Role, *ec2.SecurityGroup, error) {
+	role, err := iam.NewRole(ctx, getCommonName(name, "api-role"), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "ecs-tasks.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}]
+		}`),
+	}, options...)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// no rules; the group only identifies the API to the domain's security group
+	sg, err := ec2.NewSecurityGroup(ctx, getCommonName(name, "api-sg"), &ec2.SecurityGroupArgs{
+		VpcId: args.VpcId,
+	}, options...)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return role, sg, nil
+}
+
+func validateNetworkConfiguration(subnetCount int, instanceCount int) error {
+	if subnetCount > instanceCount {
 		return fmt.Errorf("number of subnets must be less than or equal to the number of instances")
 	}
 
 	return nil
 }
 
-func newLogGroup(ctx *pulumi.Context, name string, opts ...pulumi.ResourceOption) (*cloudwatch.LogGroup, error) {
-	lg, err := cloudwatch.NewLogGroup(ctx, getCommonName(name, "search-log-group"), &cloudwatch.LogGroupArgs{}, opts...)
+func newLogGroup(ctx *pulumi.Context, name string, kmsKeyArn pulumi.StringPtrInput, opts ...pulumi.ResourceOption) (*cloudwatch.LogGroup, error) {
+	lg, err := cloudwatch.NewLogGroup(ctx, getCommonName(name, "search-log-group"), &cloudwatch.LogGroupArgs{
+		KmsKeyId: kmsKeyArn,
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -258,4 +429,8 @@ type OpenSearch struct {
 	Endpoint   pulumi.StringOutput
 	Password   pulumi.StringOutput
 	User       pulumi.StringOutput
+
+	// only set for the managed domain
+	ApiRole          *iam.Role
+	ApiSecurityGroup *ec2.SecurityGroup
 }
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ecs"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/efs"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/servicediscovery"
+	"github.com/pulumi/pulumi-random/sdk/v4/go/random"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const openSearchContainerPort = 9200
+
+// uid/gid of the opensearch user in the official image; the EFS access point writes as this user
+const openSearchContainerUid = 1000
+
+/*
+Run a single OpenSearch node on ECS Fargate as a low cost alternative to the managed domain.
+Index data lives on an encrypted EFS file system so it survives task replacement.
+The node is registered in a private Cloud Map namespace and reached over HTTP inside the VPC with the generated admin credentials.
+Only one task runs at a time; two nodes must never share the same data directory.
+*/
+func NewOpenSearchContainer(ctx *pulumi.Context, name string, args *OpenSearchContainerArgs, opts ...pulumi.ResourceOption) (*OpenSearch, error) {
+	var resource OpenSearch
+
+	err := ctx.RegisterComponentResource("pulumi:opensearchContainer", name, &resource, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// create our parented options
+	options := append(opts, pulumi.Parent(&resource))
+
+	un := "admin"
+
+	// the security plugin rejects weak initial admin passwords
+	pw, err := random.NewRandomPassword(ctx, getCommonName(name, "pw"), &random.RandomPasswordArgs{
+		Length:          pulumi.Int(24),
+		MinLower:        pulumi.Int(1),
+		MinUpper:        pulumi.Int(1),
+		MinNumeric:      pulumi.Int(1),
+		MinSpecial:      pulumi.Int(1),
+		OverrideSpecial: pulumi.String("!#%*-_+"),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := secretsmanager.NewSecret(ctx, getCommonName(name, "admin-password"), &secretsmanager.SecretArgs{
+		KmsKeyId: args.KmsKeyArn,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = secretsmanager.NewSecretVersion(ctx, getCommonName(name, "admin-password"), &secretsmanager.SecretVersionArgs{
+		SecretId:     secret.ID(),
+		SecretString: pw.Result,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	serviceSg, err := ec2.NewSecurityGroup(ctx, getCommonName(name, "service-sg"), &ec2.SecurityGroupArgs{
+		VpcId: args.VpcId,
+		Ingress: ec2.SecurityGroupIngressArray{
+			ec2.SecurityGroupIngressArgs{
+				FromPort:    pulumi.Int(openSearchContainerPort),
+				ToPort:      pulumi.Int(openSearchContainerPort),
+				Protocol:    pulumi.String("TCP"),
+				CidrBlocks:  pulumi.StringArray{pulumi.String(args.VpcCidrBlock)},
+				Description: pulumi.String("Allows access to OpenSearch from the VPC"),
+			},
+		},
+		Egress: ec2.SecurityGroupEgressArray{
+			ec2.SecurityGroupEgressArgs{
+				FromPort:    pulumi.Int(0),
+				ToPort:      pulumi.Int(0),
+				Protocol:    pulumi.String("-1"),
+				CidrBlocks:  pulumi.ToStringArray([]string{"0.0.0.0/0"}),
+				Description: pulumi.String("Allows egress to all IP addresses"),
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	accessPoint, err := newOpenSearchStorage(ctx, name, args, serviceSg, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	logGroup, err := cloudwatch.NewLogGroup(ctx, getCommonName(name, "log-group"), &cloudwatch.LogGroupArgs{
+		KmsKeyId:        args.KmsKeyArn,
+		RetentionInDays: pulumi.Int(30),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	executionRole, err := newOpenSearchExecutionRole(ctx, name, args, secret.Arn, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the heap gets half of the task memory; the rest is left for the OS file cache
+	heapMb := args.Memory / 2
+	containerDefinitions := pulumi.All(logGroup.Name, secret.Arn).ApplyT(func(applyArgs []any) (string, error) {
+		logGroupName := applyArgs[0].(string)
+		secretArn := applyArgs[1].(string)
+
+		definitions, err := json.Marshal([]map[string]any{
+			{
+				"name":      "opensearch",
+				"image":     args.Image,
+				"essential": true,
+				"portMappings": []map[string]any{
+					{"containerPort": openSearchContainerPort, "protocol": "tcp"},
+				},
+				// single-node discovery skips the bootstrap checks, eg- vm.max_map_count, which cannot be changed on Fargate
+				"environment": []map[string]any{
+					{"name": "discovery.type", "value": "single-node"},
+					{"name": "node.store.allow_mmap", "value": "false"},
+					{"name": "plugins.security.ssl.http.enabled", "value": "false"},
+					{"name": "OPENSEARCH_JAVA_OPTS", "value": fmt.Sprintf("-Xms%dm -Xmx%dm", heapMb, heapMb)},
+				},
+				"secrets": []map[string]any{
+					{"name": "OPENSEARCH_INITIAL_ADMIN_PASSWORD", "valueFrom": secretArn},
+				},
+				"mountPoints": []map[string]any{
+					{"sourceVolume": "data", "containerPath": "/usr/share/opensearch/data"},
+				},
+				"ulimits": []map[string]any{
+					{"name": "nofile", "softLimit": 65536, "hardLimit": 65536},
+				},
+				"logConfiguration": map[string]any{
+					"logDriver": "awslogs",
+					"options": map[string]any{
+						"awslogs-group":         logGroupName,
+						"awslogs-region":        args.Region,
+						"awslogs-stream-prefix": "opensearch",
+					},
+				},
+			},
+		})
+
+		return string(definitions), err
+	}).(pulumi.StringOutput)
+
+	taskDefinition, err := ecs.NewTaskDefinition(ctx, getCommonName(name, "task-def"), &ecs.TaskDefinitionArgs{
+		Family:                  pulumi.String(getCommonName(name, "task")),
+		NetworkMode:             pulumi.String("awsvpc"),
+		Cpu:                     pulumi.String(fmt.Sprintf("%d", args.Cpu)),
+		Memory:                  pulumi.String(fmt.Sprintf("%d", args.Memory)),
+		RequiresCompatibilities: pulumi.StringArray{pulumi.String("FARGATE")},
+		ExecutionRoleArn:        executionRole.Arn,
+		ContainerDefinitions:    containerDefinitions,
+		Volumes: ecs.TaskDefinitionVolumeArray{
+			ecs.TaskDefinitionVolumeArgs{
+				Name: pulumi.String("data"),
+				EfsVolumeConfiguration: ecs.TaskDefinitionVolumeEfsVolumeConfigurationArgs{
+					FileSystemId:      accessPoint.FileSystemId,
+					TransitEncryption: pulumi.String("ENABLED"),
+					AuthorizationConfig: ecs.TaskDefinitionVolumeEfsVolumeConfigurationAuthorizationConfigArgs{
+						AccessPointId: accessPoint.ID(),
+					},
+				},
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err := servicediscovery.NewPrivateDnsNamespace(ctx, getCommonName(name, "namespace"), &servicediscovery.PrivateDnsNamespaceArgs{
+		Name: pulumi.String(fmt.Sprintf("%s.local", name)),
+		Vpc:  args.VpcId,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryService, err := servicediscovery.NewService(ctx, getCommonName(name, "discovery"), &servicediscovery.ServiceArgs{
+		Name: pulumi.String(args.DomainName),
+		DnsConfig: servicediscovery.ServiceDnsConfigArgs{
+			NamespaceId: namespace.ID(),
+			DnsRecords: servicediscovery.ServiceDnsConfigDnsRecordArray{
+				servicediscovery.ServiceDnsConfigDnsRecordArgs{
+					Type: pulumi.String("A"),
+					Ttl:  pulumi.Int(10),
+				},
+			},
+		},
+		ForceDestroy: pulumi.Bool(true),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, err := ecs.NewCluster(ctx, getCommonName(name, "cluster"), &ecs.ClusterArgs{}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// stop the old task before starting the new one so only one node ever writes to the data directory
+	_, err = ecs.NewService(ctx, getCommonName(name, "ecs"), &ecs.ServiceArgs{
+		Cluster:                         cluster.ID(),
+		DesiredCount:                    pulumi.Int(1),
+		DeploymentMinimumHealthyPercent: pulumi.Int(0),
+		DeploymentMaximumPercent:        pulumi.Int(100),
+		LaunchType:                      pulumi.String("FARGATE"),
+		NetworkConfiguration: ecs.ServiceNetworkConfigurationArgs{
+			AssignPublicIp: pulumi.Bool(false),
+			Subnets:        args.SubnetIds,
+			SecurityGroups: pulumi.StringArray{serviceSg.ID()},
+		},
+		ServiceRegistries: ecs.ServiceServiceRegistriesArgs{
+			RegistryArn: discoveryService.Arn,
+		},
+		TaskDefinition:       taskDefinition.Arn,
+		WaitForSteadyState:   pulumi.Bool(false),
+		EnableEcsManagedTags: pulumi.Bool(true),
+		PropagateTags:        pulumi.String("SERVICE"),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resource.User = pulumi.String(un).ToStringOutput()
+	resource.Password = pw.Result
+	resource.DomainName = pulumi.String(args.DomainName).ToStringOutput()
+	resource.Endpoint = namespace.Name.ApplyT(func(namespaceName string) string {
+		return fmt.Sprintf("http://%s.%s:%d", args.DomainName, namespaceName, openSearchContainerPort)
+	}).(pulumi.StringOutput)
+
+	return &resource, nil
+}
+
+// create the encrypted EFS file system, a mount target per subnet and an access point owned by the opensearch user
+func newOpenSearchStorage(ctx *pulumi.Context, name string, args *OpenSearchContainerArgs, serviceSg *ec2.SecurityGroup, options ...pulumi.ResourceOption) (*efs.AccessPoint, error) {
+	fileSystem, err := efs.NewFileSystem(ctx, getCommonName(name, "data"), &efs.FileSystemArgs{
+		Encrypted: pulumi.Bool(true),
+		KmsKeyId:  args.KmsKeyArn,
+	}, append(options, pulumi.Protect(true))...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	efsSg, err := ec2.NewSecurityGroup(ctx, getCommonName(name, "efs-sg"), &ec2.SecurityGroupArgs{
+		VpcId: args.VpcId,
+		Ingress: ec2.SecurityGroupIngressArray{
+			ec2.SecurityGroupIngressArgs{
+				FromPort:       pulumi.Int(2049),
+				ToPort:         pulumi.Int(2049),
+				Protocol:       pulumi.String("TCP"),
+				SecurityGroups: pulumi.StringArray{serviceSg.ID()},
+				Description:    pulumi.String("Allows NFS from the OpenSearch task"),
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var mountTargets []pulumi.Resource
+	for i := 0; i < args.SubnetCount; i++ {
+		mountTarget, err := efs.NewMountTarget(ctx, getCommonName(name, fmt.Sprintf("mount-%d", i)), &efs.MountTargetArgs{
+			FileSystemId:   fileSystem.ID(),
+			SubnetId:       args.SubnetIds.Index(pulumi.Int(i)),
+			SecurityGroups: pulumi.StringArray{efsSg.ID()},
+		}, options...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mountTargets = append(mountTargets, mountTarget)
+	}
+
+	// tasks can only mount the file system once a mount target exists in their subnet
+	accessPointOptions := append(options, pulumi.DependsOn(mountTargets))
+	return efs.NewAccessPoint(ctx, getCommonName(name, "access-point"), &efs.AccessPointArgs{
+		FileSystemId: fileSystem.ID(),
+		PosixUser: efs.AccessPointPosixUserArgs{
+			Uid: pulumi.Int(openSearchContainerUid),
+			Gid: pulumi.Int(openSearchContainerUid),
+		},
+		RootDirectory: efs.AccessPointRootDirectoryArgs{
+			Path: pulumi.String("/opensearch"),
+			CreationInfo: efs.AccessPointRootDirectoryCreationInfoArgs{
+				OwnerUid:    pulumi.Int(openSearchContainerUid),
+				OwnerGid:    pulumi.Int(openSearchContainerUid),
+				Permissions: pulumi.String("755"),
+			},
+		},
+	}, accessPointOptions...)
+}
+
+// the execution role pulls the image, writes logs and reads the admin password secret
+func newOpenSearchExecutionRole(ctx *pulumi.Context, name string, args *OpenSearchContainerArgs, secretArn pulumi.StringOutput, options ...pulumi.ResourceOption) (*iam.Role, error) {
+	role, err := iam.NewRole(ctx, getCommonName(name, "execution-role"), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "ecs-tasks.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}]
+		}`),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = iam.NewRolePolicyAttachment(ctx, getCommonName(name, "execution-policy"), &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String(common.GetIamPolicyArn(args.Region, "arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy")),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy := pulumi.All(secretArn, args.KmsKeyArn).ApplyT(func(applyArgs []any) (string, error) {
+		statements := []map[string]any{
+			{
+				"Effect":   "Allow",
+				"Action":   "secretsmanager:GetSecretValue",
+				"Resource": applyArgs[0].(string),
+			},
+		}
+
+		// the secret is encrypted with the data key when one is configured
+		if kmsKeyArn := resolvedKmsKeyArn(applyArgs[1]); kmsKeyArn != "" {
+			statements = append(statements, map[string]any{
+				"Effect":   "Allow",
+				"Action":   "kms:Decrypt",
+				"Resource": kmsKeyArn,
+			})
+		}
+
+		doc, err := json.Marshal(map[string]any{
+			"Version":   "2012-10-17",
+			"Statement": statements,
+		})
+
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	_, err = iam.NewRolePolicy(ctx, getCommonName(name, "secret-policy"), &iam.RolePolicyArgs{
+		Role:   role.Name,
+		Policy: policy,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+type OpenSearchContainerArgs struct {
+	Region       string
+	DomainName   string
+	Image        string
+	Cpu          int
+	Memory       int
+	VpcId        pulumi.StringOutput
+	VpcCidrBlock string
+	SubnetIds    pulumi.StringArrayOutput
+	SubnetCount  int
+	KmsKeyArn    pulumi.StringPtrInput
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/opensearch"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+/*
+Provision an OpenSearch Serverless collection in place of the managed domain, so there are no nodes or volumes to size.
+The collection is only reachable through its own VPC endpoint. There is no admin user; the API signs its requests with its task role,
+and the application stack grants that role access to the collection's indexes with a data access policy.
+*/
+func NewOpenSearchServerless(ctx *pulumi.Context, name string, args *OpenSearchServerlessArgs, opts ...pulumi.ResourceOption) (*OpenSearch, error) {
+	var resource OpenSearch
+
+	err := ctx.RegisterComponentResource("pulumi:opensearchServerless", name, &resource, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// create our parented options
+	options := append(opts, pulumi.Parent(&resource))
+
+	encryptionPolicy := pulumi.All(args.KmsKeyArn).ApplyT(func(applyArgs []any) (string, error) {
+		doc, err := json.Marshal(common.OpenSearchEncryptionPolicy(args.CollectionName, resolvedKmsKeyArn(applyArgs[0])))
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	encryption, err := opensearch.NewServerlessSecurityPolicy(ctx, getCommonName(name, "encryption"), &opensearch.ServerlessSecurityPolicyArgs{
+		Name:   pulumi.String(fmt.Sprintf("%s-enc", args.CollectionName)),
+		Type:   pulumi.String("encryption"),
+		Policy: encryptionPolicy,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpointSg, err := ec2.NewSecurityGroup(ctx, getCommonName(name, "endpoint-sg"), &ec2.SecurityGroupArgs{
+		VpcId: args.VpcId,
+		Ingress: ec2.SecurityGroupIngressArray{
+			ec2.SecurityGroupIngressArgs{
+				FromPort:    pulumi.Int(443),
+				ToPort:      pulumi.Int(443),
+				Protocol:    pulumi.String("TCP"),
+				CidrBlocks:  pulumi.StringArray{pulumi.String(args.VpcCidrBlock)},
+				Description: pulumi.String("Allows access to the OpenSearch Serverless endpoint from the VPC"),
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := opensearch.NewServerlessVpcEndpoint(ctx, getCommonName(name, "endpoint"), &opensearch.ServerlessVpcEndpointArgs{
+		Name:             pulumi.String(fmt.Sprintf("%s-vpc", args.CollectionName)),
+		VpcId:            args.VpcId,
+		SubnetIds:        args.SubnetIds,
+		SecurityGroupIds: pulumi.StringArray{endpointSg.ID()},
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	networkPolicy := endpoint.ID().ApplyT(func(endpointId string) (string, error) {
+		doc, err := json.Marshal(common.OpenSearchNetworkPolicy(args.CollectionName, endpointId))
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	network, err := opensearch.NewServerlessSecurityPolicy(ctx, getCommonName(name, "network"), &opensearch.ServerlessSecurityPolicyArgs{
+		Name:   pulumi.String(fmt.Sprintf("%s-net", args.CollectionName)),
+		Type:   pulumi.String("network"),
+		Policy: networkPolicy,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a collection can only be created once an encryption policy covers its name
+	collectionOptions := append(options, pulumi.DependsOn([]pulumi.Resource{encryption, network}))
+	collection, err := opensearch.NewServerlessCollection(ctx, getCommonName(name, "collection"), &opensearch.ServerlessCollectionArgs{
+		Name: pulumi.String(args.CollectionName),
+		Type: pulumi.String("SEARCH"),
+	}, collectionOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// requests are signed with the task role, so there are no credentials to hand to the application
+	resource.User = pulumi.String("").ToStringOutput()
+	resource.Password = pulumi.String("").ToStringOutput()
+	resource.DomainName = collection.Name
+	resource.Endpoint = collection.CollectionEndpoint
+
+	return &resource, nil
+}
+
+type OpenSearchServerlessArgs struct {
+	CollectionName string
+	VpcId          pulumi.StringOutput
+	VpcCidrBlock   string
+	SubnetIds      pulumi.StringArrayOutput
+	KmsKeyArn      pulumi.StringPtrInput
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/lambda"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/opensearch"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/s3"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+//go:embed scripts/opensearch_setup.py
+var openSearchSetupScript string
+
+const openSearchSnapshotRepository = "pulumi-snapshots"
+
+/*
+Manual snapshots of the search domain to a dedicated S3 bucket, so the resource search index can be restored instead of rebuilt.
+The domain is only reachable from inside the VPC, so a function in the private subnets registers the repository,
+the snapshot management policy and the ISM policy each time their settings change.
+*/
+func newOpenSearchSnapshots(ctx *pulumi.Context, name string, args *OpenSearchArgs, domain *opensearch.Domain, setupSg *ec2.SecurityGroup, user string, password pulumi.StringOutput, options ...pulumi.ResourceOption) error {
+	kmsKeyArn := pulumi.All(args.KmsKeyArn).ApplyT(func(applyArgs []any) string {
+		return resolvedKmsKeyArn(applyArgs[0])
+	}).(pulumi.StringOutput)
+
+	bucket, err := s3.NewBucket(ctx, getCommonName(name, "snapshots"), &s3.BucketArgs{}, append(options, pulumi.Protect(true))...)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3.NewBucketPublicAccessBlock(ctx, getCommonName(name, "snapshots-public-access"), &s3.BucketPublicAccessBlockArgs{
+		Bucket:                bucket.ID(),
+		BlockPublicAcls:       pulumi.Bool(true),
+		BlockPublicPolicy:     pulumi.Bool(true),
+		IgnorePublicAcls:      pulumi.Bool(true),
+		RestrictPublicBuckets: pulumi.Bool(true),
+	}, options...)
+
+	if err != nil {
+		return err
+	}
+
+	algorithm := kmsKeyArn.ApplyT(func(arn string) string {
+		if arn == "" {
+			return "AES256"
+		}
+		return "aws:kms"
+	}).(pulumi.StringOutput)
+
+	_, err = s3.NewBucketServerSideEncryptionConfigurationV2(ctx, getCommonName(name, "snapshots-encryption"), &s3.BucketServerSideEncryptionConfigurationV2Args{
+		Bucket: bucket.ID(),
+		Rules: s3.BucketServerSideEncryptionConfigurationV2RuleArray{
+			&s3.BucketServerSideEncryptionConfigurationV2RuleArgs{
+				ApplyServerSideEncryptionByDefault: &s3.BucketServerSideEncryptionConfigurationV2RuleApplyServerSideEncryptionByDefaultArgs{
+					SseAlgorithm:   algorithm,
+					KmsMasterKeyId: args.KmsKeyArn,
+				},
+				BucketKeyEnabled: pulumi.Bool(true),
+			},
+		},
+	}, options...)
+
+	if err != nil {
+		return err
+	}
+
+	// OpenSearch assumes this role to read and write snapshots
+	snapshotRole, err := iam.NewRole(ctx, getCommonName(name, "snapshot-role"), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "es.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}]
+		}`),
+	}, options...)
+
+	if err != nil {
+		return err
+	}
+
+	snapshotPolicy := pulumi.All(bucket.Arn, kmsKeyArn).ApplyT(func(applyArgs []any) (string, error) {
+		bucketArn := applyArgs[0].(string)
+		statements := []map[string]any{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:ListBucket"},
+				"Resource": []string{bucketArn},
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:GetObject", "s3:PutObject", "s3:DeleteObject"},
+				"Resource": []string{fmt.Sprintf("%s/*", bucketArn)},
+			},
+		}
+
+		if kmsKeyArn := applyArgs[1].(string); kmsKeyArn != "" {
+			statements = append(statements, map[string]any{
+				"Effect":   "Allow",
+				"Action":   []string{"kms:Decrypt", "kms:GenerateDataKey"},
+				"Resource": []string{kmsKeyArn},
+			})
+		}
+
+		doc, err := json.Marshal(map[string]any{
+			"Version":   "2012-10-17",
+			"Statement": statements,
+		})
+
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	_, err = iam.NewRolePolicy(ctx, getCommonName(name, "snapshot-policy"), &iam.RolePolicyArgs{
+		Role:   snapshotRole.Name,
+		Policy: snapshotPolicy,
+	}, options...)
+
+	if err != nil {
+		return err
+	}
+
+	setupFunction, err := newOpenSearchSetupFunction(ctx, name, args, domain, snapshotRole, setupSg, options...)
+	if err != nil {
+		return err
+	}
+
+	// the function's role is mapped to manage_snapshots so its signed request can pass the snapshot role to the domain
+	input := pulumi.All(domain.Endpoint, password, bucket.Bucket, snapshotRole.Arn, setupFunction.Role).ApplyT(func(applyArgs []any) (string, error) {
+		requests := []map[string]any{
+			{
+				"method": "PUT",
+				"path":   "/_plugins/_security/api/rolesmapping/manage_snapshots",
+				"body":   map[string]any{"backend_roles": []string{applyArgs[4].(string)}},
+			},
+			{
+				"method": "PUT",
+				"path":   fmt.Sprintf("/_snapshot/%s", openSearchSnapshotRepository),
+				"signed": true,
+				"body": map[string]any{
+					"type": "s3",
+					"settings": map[string]any{
+						"bucket":                 applyArgs[2].(string),
+						"region":                 args.Region,
+						"role_arn":               applyArgs[3].(string),
+						"server_side_encryption": true,
+					},
+				},
+			},
+			{
+				"method": "PUT",
+				"path":   fmt.Sprintf("/_plugins/_sm/policies/%s", openSearchSnapshotRepository),
+				"body":   common.OpenSearchSnapshotPolicy(openSearchSnapshotRepository, args.SnapshotSchedule, args.SnapshotRetentionCount),
+			},
+			{
+				"method": "PUT",
+				"path":   "/_plugins/_ism/policies/pulumi-rollover",
+				"body":   common.OpenSearchIsmPolicy(args.IsmIndexPatterns, args.RolloverDays, args.IndexRetentionDays),
+			},
+		}
+
+		doc, err := json.Marshal(map[string]any{
+			"endpoint": fmt.Sprintf("https://%s", applyArgs[0].(string)),
+			"username": user,
+			"password": applyArgs[1].(string),
+			"requests": requests,
+		})
+
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	// the input carries the master password and is a secret; changes to it, eg- a new schedule, invoke the function again
+	_, err = lambda.NewInvocation(ctx, getCommonName(name, "setup"), &lambda.InvocationArgs{
+		FunctionName: setupFunction.Name,
+		Input:        input,
+	}, options...)
+
+	return err
+}
+
+// the domain's security group admits the setup function through this group, so it is created along with the domain
+func newOpenSearchSetupSecurityGroup(ctx *pulumi.Context, name string, args *OpenSearchArgs, options ...pulumi.ResourceOption) (*ec2.SecurityGroup, error) {
+	return ec2.NewSecurityGroup(ctx, getCommonName(name, "setup-sg"), &ec2.SecurityGroupArgs{
+		VpcId: args.VpcId,
+		Egress: ec2.SecurityGroupEgressArray{
+			&ec2.SecurityGroupEgressArgs{
+				Protocol:    pulumi.String("tcp"),
+				FromPort:    pulumi.Int(443),
+				ToPort:      pulumi.Int(443),
+				CidrBlocks:  pulumi.StringArray{pulumi.String(args.VpcCidrBlock)},
+				Description: pulumi.String("Allow the setup function to connect to OpenSearch"),
+			},
+		},
+	}, options...)
+}
+
+// function in the private subnets that applies requests to the domain; see scripts/opensearch_setup.py
+// it has its own role, which it maps as a backend role of the domain with the admin user
+func newOpenSearchSetupFunction(ctx *pulumi.Context, name string, args *OpenSearchArgs, domain *opensearch.Domain, snapshotRole *iam.Role, sg *ec2.SecurityGroup, options ...pulumi.ResourceOption) (*lambda.Function, error) {
+	role, err := iam.NewRole(ctx, getCommonName(name, "setup-role"), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "lambda.amazonaws.com"
+				},
+				"Action": "sts:AssumeRole"
+			}]
+		}`),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = iam.NewRolePolicyAttachment(ctx, getCommonName(name, "setup-vpc-access"), &iam.RolePolicyAttachmentArgs{
+		Role:      role.Name,
+		PolicyArn: pulumi.String(common.GetIamPolicyArn(args.Region, "arn:aws:iam::aws:policy/service-role/AWSLambdaVPCAccessExecutionRole")),
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy := pulumi.All(snapshotRole.Arn, domain.Arn).ApplyT(func(applyArgs []any) (string, error) {
+		doc, err := json.Marshal(map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []map[string]any{
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"iam:PassRole"},
+					"Resource": []string{applyArgs[0].(string)},
+				},
+				{
+					"Effect":   "Allow",
+					"Action":   []string{"es:ESHttpPut"},
+					"Resource": []string{fmt.Sprintf("%s/*", applyArgs[1].(string))},
+				},
+			},
+		})
+
+		return string(doc), err
+	}).(pulumi.StringOutput)
+
+	rolePolicy, err := iam.NewRolePolicy(ctx, getCommonName(name, "setup-policy"), &iam.RolePolicyArgs{
+		Role:   role.Name,
+		Policy: policy,
+	}, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the function can only be invoked once it can reach the domain and pass the snapshot role
+	functionOptions := append(options, pulumi.DependsOn([]pulumi.Resource{domain, rolePolicy}))
+	return lambda.NewFunction(ctx, getCommonName(name, "setup"), &lambda.FunctionArgs{
+		Runtime: pulumi.String("python3.12"),
+		Handler: pulumi.String("index.handler"),
+		Role:    role.Arn,
+		Timeout: pulumi.Int(120),
+		Code: pulumi.NewAssetArchive(map[string]any{
+			"index.py": pulumi.NewStringAsset(openSearchSetupScript),
+		}),
+		VpcConfig: &lambda.FunctionVpcConfigArgs{
+			SubnetIds:        args.SubnetIds,
+			SecurityGroupIds: pulumi.StringArray{sg.ID()},
+		},
+	}, functionOptions...)
+}
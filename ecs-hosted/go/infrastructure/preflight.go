@@ -0,0 +1,185 @@
+package main
+
+import (
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/kms"
+	"github.com/pulumi/pulumi-aws/sdk/v7/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi-self-hosted-installers/ecs-hosted/infrastructure/common"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+/*
+Look up the resources referenced by configuration before anything is created.
+Every problem found is collected so a single update reports all of them, rather than failing on the first one part way through.
+*/
+func runPreflight(ctx *pulumi.Context, configValues *ConfigValues) error {
+	var report common.PreflightReport
+
+	// number of private subnets, and the zones they span, that OpenSearch will be placed in
+	privateSubnetCount := configValues.VpcAvailabilityZoneCount
+	privateAzCount := configValues.VpcAvailabilityZoneCount
+
+	if !configValues.CreateVpc {
+		_, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{
+			Id: &configValues.VpcId,
+		})
+
+		if err != nil {
+			report.Addf("vpcId %s was not found: %v", configValues.VpcId, err)
+		} else {
+			// ALBs, the Aurora subnet group and OpenSearch zone awareness all need at least 2 zones
+			checkSubnetTier(ctx, &report, "publicSubnetIds", configValues.PublicSubnetIds, configValues.VpcId)
+			checkSubnetTier(ctx, &report, "isolatedSubnetIds", configValues.IsolatedSubnetIds, configValues.VpcId)
+			privateAzCount = checkSubnetTier(ctx, &report, "privateSubnetIds", configValues.PrivateSubnetIds, configValues.VpcId)
+			privateSubnetCount = len(configValues.PrivateSubnetIds)
+		}
+	}
+
+	if configValues.EnableOpenSearch {
+		// a created VPC only places the domain in as many of its zones as there are instances
+		domainSubnetCount, domainAzCount := privateSubnetCount, privateAzCount
+		if configValues.CreateVpc {
+			domainSubnetCount = min(privateSubnetCount, configValues.OpenSearchInstanceCount)
+			domainAzCount = domainSubnetCount
+		}
+
+		report.AddAll(common.ValidateOpenSearchTopology(domainSubnetCount, domainAzCount, configValues.OpenSearchInstanceCount, configValues.OpenSearchDedicatedMasterCount))
+		report.AddAll(common.ValidateOpenSearchDomain(common.OpenSearchDomainOptions{
+			EngineVersion:        configValues.OpenSearchEngineVersion,
+			InstanceType:         configValues.OpenSearchInstanceType,
+			DedicatedMasterCount: configValues.OpenSearchDedicatedMasterCount,
+			DedicatedMasterType:  configValues.OpenSearchDedicatedMasterType,
+			VolumeType:           configValues.OpenSearchVolumeType,
+			VolumeSize:           configValues.OpenSearchVolumeSize,
+			VolumeIops:           configValues.OpenSearchVolumeIops,
+			VolumeThroughput:     configValues.OpenSearchVolumeThroughput,
+			WarmCount:            configValues.OpenSearchWarmCount,
+			WarmType:             configValues.OpenSearchWarmType,
+			ColdStorage:          configValues.OpenSearchEnableColdStorage,
+		}))
+
+		if configValues.OpenSearchEnableSnapshots {
+			report.AddAll(common.ValidateOpenSearchSnapshots(configValues.OpenSearchSnapshotRetentionCount, configValues.OpenSearchRolloverDays, configValues.OpenSearchIndexRetentionDays))
+		}
+	}
+
+	// EFS allows a single mount target per availability zone
+	if configValues.UseOpenSearchContainer && privateAzCount != privateSubnetCount {
+		report.Addf("useOpenSearchContainer needs each private subnet in a different availability zone; %d subnets span %d zones", privateSubnetCount, privateAzCount)
+	}
+
+	// without a NAT the container image can only be pulled from private ECR
+	if configValues.UseOpenSearchContainer && configValues.EnableNatlessMode {
+		report.AddAll(common.ValidateNatlessImage("openSearchContainerImage", configValues.OpenSearchContainerImage))
+	}
+
+	if (configValues.UseOpenSearchContainer || configValues.UseOpenSearchServerless) && configValues.OpenSearchEnableSnapshots {
+		report.Addf("enableOpenSearchSnapshots is only supported for the managed OpenSearch domain, not useOpenSearchContainer or useOpenSearchServerless")
+	}
+
+	if configValues.DataKmsKeyArn != "" {
+		checkKmsKey(ctx, &report, "dataKmsKeyArn", configValues.DataKmsKeyArn, configValues.Region)
+	}
+
+	// the DR key lives in the DR region and cannot be looked up with the primary provider
+	if configValues.DbDrKmsKeyArn != "" {
+		region, err := common.ArnRegion(configValues.DbDrKmsKeyArn)
+		if err != nil {
+			report.Addf("dbDrKmsKeyArn must be a key ARN: %v", err)
+		} else if region != configValues.DbDrRegion {
+			report.Addf("dbDrKmsKeyArn is in %s but dbDrRegion is %s", region, configValues.DbDrRegion)
+		}
+	}
+
+	if configValues.UseExistingDb {
+		sg, err := ec2.LookupSecurityGroup(ctx, &ec2.LookupSecurityGroupArgs{
+			Id: &configValues.ExistingDbSecurityGroupId,
+		})
+
+		if err != nil {
+			report.Addf("existingDbSecurityGroupId %s was not found: %v", configValues.ExistingDbSecurityGroupId, err)
+		} else if !configValues.CreateVpc && sg.VpcId != configValues.VpcId {
+			report.Addf("existingDbSecurityGroupId %s belongs to %s, not vpcId %s", configValues.ExistingDbSecurityGroupId, sg.VpcId, configValues.VpcId)
+		}
+
+		secret, err := secretsmanager.LookupSecret(ctx, &secretsmanager.LookupSecretArgs{
+			Arn: &configValues.ExistingDbCredentialsSecretArn,
+		})
+
+		if err != nil {
+			report.Addf("existingDbCredentialsSecretArn %s was not found: %v", configValues.ExistingDbCredentialsSecretArn, err)
+		} else if secret.KmsKeyId != "" {
+			// a DBA managed secret may be encrypted with its own key, which the tasks need to decrypt it; aws/secretsmanager needs no grant
+			key, err := kms.LookupKey(ctx, &kms.LookupKeyArgs{
+				KeyId: secret.KmsKeyId,
+			})
+
+			if err != nil {
+				report.Addf("the key %s of existingDbCredentialsSecretArn cannot be described: %v", secret.KmsKeyId, err)
+			} else if key.KeyManager == "CUSTOMER" {
+				configValues.ExistingDbCredentialsKmsKeyArn = key.Arn
+			}
+		}
+	}
+
+	return report.Err()
+}
+
+// check each subnet exists in the VPC and return the number of availability zones the tier spans
+func checkSubnetTier(ctx *pulumi.Context, report *common.PreflightReport, configKey string, subnetIds []string, vpcId string) int {
+	azs := map[string]bool{}
+
+	for _, id := range subnetIds {
+		subnet, err := ec2.LookupSubnet(ctx, &ec2.LookupSubnetArgs{
+			Id: pulumi.StringRef(id),
+		})
+
+		if err != nil {
+			report.Addf("%s: subnet %s was not found: %v", configKey, id, err)
+			continue
+		}
+
+		if subnet.VpcId != vpcId {
+			report.Addf("%s: subnet %s belongs to %s, not vpcId %s", configKey, id, subnet.VpcId, vpcId)
+		}
+
+		azs[subnet.AvailabilityZone] = true
+	}
+
+	if len(azs) > 0 && len(azs) < 2 {
+		report.Addf("%s must span at least 2 availability zones; all subnets are in %d", configKey, len(azs))
+	}
+
+	return len(azs)
+}
+
+// customer managed keys must be enabled symmetric encryption keys in the deployment region
+func checkKmsKey(ctx *pulumi.Context, report *common.PreflightReport, configKey string, keyArn string, region string) {
+	keyRegion, err := common.ArnRegion(keyArn)
+	if err != nil {
+		report.Addf("%s must be a key ARN: %v", configKey, err)
+		return
+	}
+
+	if keyRegion != region {
+		report.Addf("%s is in %s but aws:region is %s", configKey, keyRegion, region)
+		return
+	}
+
+	key, err := kms.LookupKey(ctx, &kms.LookupKeyArgs{
+		KeyId: keyArn,
+	})
+
+	if err != nil {
+		report.Addf("%s %s was not found or cannot be described: %v", configKey, keyArn, err)
+		return
+	}
+
+	if key.KeyState != "Enabled" {
+		report.Addf("%s %s is %s; it must be Enabled", configKey, keyArn, key.KeyState)
+	}
+
+	if key.KeyUsage != "ENCRYPT_DECRYPT" {
+		report.Addf("%s %s has usage %s; it must be an ENCRYPT_DECRYPT key", configKey, keyArn, key.KeyUsage)
+	}
+}
@@ -0,0 +1,48 @@
+# Applies a list of requests to an OpenSearch domain from inside the VPC.
+# Requests are sent with the master user's basic auth, or signed with the function's role when "signed" is set,
+# eg- registering a snapshot repository requires a signed request to pass the snapshot role.
+import base64
+import json
+import os
+import urllib.error
+import urllib.request
+
+import boto3
+from botocore.auth import SigV4Auth
+from botocore.awsrequest import AWSRequest
+
+
+def send(event, method, path, body=None, signed=False):
+    url = event["endpoint"].rstrip("/") + path
+    data = json.dumps(body).encode() if body is not None else None
+    headers = {"Content-Type": "application/json"}
+
+    if signed:
+        request = AWSRequest(method=method, url=url, data=data, headers=headers)
+        SigV4Auth(boto3.Session().get_credentials(), "es", os.environ["AWS_REGION"]).add_auth(request)
+        headers = dict(request.headers)
+    else:
+        user = "{}:{}".format(event["username"], event["password"]).encode()
+        headers["Authorization"] = "Basic " + base64.b64encode(user).decode()
+
+    request = urllib.request.Request(url, data=data, headers=headers, method=method)
+    with urllib.request.urlopen(request, timeout=30) as response:
+        return json.loads(response.read() or b"{}")
+
+
+def handler(event, context):
+    for r in event["requests"]:
+        try:
+            send(event, r["method"], r["path"], r.get("body"), r.get("signed", False))
+        except urllib.error.HTTPError as e:
+            # ISM and snapshot management policies can only be replaced with the sequence number of the current version
+            if e.code != 409:
+                raise Exception("{} {} failed with {}: {}".format(r["method"], r["path"], e.code, e.read().decode()))
+
+            current = send(event, "GET", r["path"])
+            path = "{}?if_seq_no={}&if_primary_term={}".format(r["path"], current["_seq_no"], current["_primary_term"])
+            send(event, r["method"], path, r.get("body"), r.get("signed", False))
+
+        print("applied", r["method"], r["path"])
+
+    return {"applied": len(event["requests"])}
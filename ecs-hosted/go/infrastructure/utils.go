@@ -7,3 +7,17 @@ import (
 func ToCommonName(first string, second string) string {
 	return fmt.Sprintf("%s-%s", first, second)
 }
+
+// the resolved value of an optional KMS key ARN input inside an apply; empty when no key is configured
+func resolvedKmsKeyArn(v any) string {
+	switch arn := v.(type) {
+	case string:
+		return arn
+	case *string:
+		if arn != nil {
+			return *arn
+		}
+	}
+
+	return ""
+}